@@ -1,62 +1,118 @@
 package blockchain
 
 import (
-	"blockchain-tutorial/utils"
 	"bytes"
-	"crypto/sha256"
+	"context"
 	"encoding/gob"
 	"fmt"
+	"time"
 )
 
+const (
+	// a versão 2 separa as folhas dos nós internos na merkle tree
+	BlockVersion = 2
+
+	// versão dos blocos criados antes dela, que continuam validos
+	legacyBlockVersion = 1
+)
+
+// BlockHeader contém os campos usados na prova de trabalho,
+// o hash do bloco é calculado apenas sobre o header serializado
+type BlockHeader struct {
+	Version    int
+	Height     int
+	Timestamp  int64
+	PrevHash   []byte
+	MerkleRoot []byte
+	Bits       uint32
+	Nonce      int
+}
+
 type Block struct {
+	BlockHeader
 	Hash         []byte
 	Transactions []*Transaction
-	PrevHash     []byte
-	Nonce        int
+}
+
+// serializa o header em um formato fixo, independente do gob
+func (h BlockHeader) Bytes() []byte {
+	return bytes.Join(
+		[][]byte{
+			Int64ToHex(int64(h.Version)),
+			Int64ToHex(int64(h.Height)),
+			Int64ToHex(h.Timestamp),
+			h.PrevHash,
+			h.MerkleRoot,
+			Int64ToHex(int64(h.Bits)),
+			Int64ToHex(int64(h.Nonce)),
+		},
+		[]byte{},
+	)
 }
 
 func (b *Block) HashTransactions() []byte {
+	return b.MerkleTree().Root()
+}
+
+func (b *Block) MerkleTree() *MerkleTree {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.ID)
 	}
 
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
+	return NewMerkleTree(txHashes, b.Version)
+}
 
-	return txHash[:]
+// retorna a prova de que a transação está incluida neste bloco
+func (b *Block) MerkleProof(txID []byte) (MerkleProof, error) {
+	for index, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			proof, err := b.MerkleTree().Proof(index)
+			proof.TxID = tx.ID
+			return proof, err
+		}
+	}
+
+	return MerkleProof{}, ErrTxNotInTree
 }
 
-func (b *Block) Serialize() []byte {
+// falha quando o bloco possui uma transação nil
+func (b *Block) Serialize() ([]byte, error) {
 	var buff bytes.Buffer
 	encoder := gob.NewEncoder(&buff)
 
-	err := encoder.Encode(b)
-
-	utils.HandleError(err)
+	if err := encoder.Encode(b); err != nil {
+		return nil, err
+	}
 
-	return buff.Bytes()
+	return buff.Bytes(), nil
 }
 
-func Deserialize(data []byte) *Block {
+func Deserialize(data []byte) (*Block, error) {
 	var block Block
 
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 
 	err := decoder.Decode(&block)
+	if err != nil {
+		return nil, err
+	}
 
-	utils.HandleError(err)
-
-	return &block
+	return &block, nil
 }
 
 func (b *Block) Info(pow string) {
 	fmt.Println("==============================================================================")
-	fmt.Printf("Hash:     %x\n", string(b.Hash))
-	fmt.Printf("PrevHash: %x\n", string(b.PrevHash))
-	fmt.Printf("PoW:      %v\n", pow)
-	fmt.Printf("Nonce:    %v\n", b.Nonce)
+	fmt.Printf("Hash:       %x\n", string(b.Hash))
+	fmt.Printf("Version:    %d\n", b.Version)
+	fmt.Printf("Height:     %d\n", b.Height)
+	fmt.Printf("Timestamp:  %s\n", time.Unix(b.Timestamp, 0).Format(time.RFC3339))
+	fmt.Printf("PrevHash:   %x\n", string(b.PrevHash))
+	fmt.Printf("MerkleRoot: %x\n", b.MerkleRoot)
+	fmt.Printf("Bits:       %08x\n", b.Bits)
+	fmt.Printf("PoW:        %v\n", pow)
+	fmt.Printf("Nonce:      %v\n", b.Nonce)
 	//fmt.Println("Transactions:")
 	//utils.Console(b.Transactions)
 	for _, tx := range b.Transactions {
@@ -65,13 +121,30 @@ func (b *Block) Info(pow string) {
 	fmt.Println()
 }
 
-func CreateBlock(txs []*Transaction, prevHash []byte) *Block {
-	block := &Block{Hash: []byte{}, Transactions: txs, PrevHash: prevHash, Nonce: 0}
+func CreateBlock(ctx context.Context, txs []*Transaction, prevHash []byte, height int, timestamp int64, bits uint32, opts MiningOptions) (*Block, error) {
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:   BlockVersion,
+			Height:    height,
+			Timestamp: timestamp,
+			PrevHash:  prevHash,
+			Bits:      bits,
+			Nonce:     0,
+		},
+		Hash:         []byte{},
+		Transactions: txs,
+	}
+	block.MerkleRoot = block.HashTransactions()
+
 	pow := NewProofOfWork(block)
-	block.Nonce, block.Hash = pow.Run()
-	return block
+	nonce, hash, err := pow.Run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	block.Nonce, block.Hash = nonce, hash
+	return block, nil
 }
 
-func Genesis(coinbaseTx *Transaction) *Block {
-	return CreateBlock([]*Transaction{coinbaseTx}, []byte{})
+func Genesis(coinbaseTx *Transaction) (*Block, error) {
+	return CreateBlock(context.Background(), []*Transaction{coinbaseTx}, []byte{}, 0, time.Now().Unix(), DifficultyToBits(InitialDifficulty), DefaultMiningOptions)
 }
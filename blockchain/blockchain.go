@@ -1,111 +1,207 @@
 package blockchain
 
 import (
-	"blockchain-tutorial/utils"
+	"blockchain-tutorial/wallet"
 	"bytes"
-	"crypto/ecdsa"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/big"
 	"os"
-	"runtime"
+	"path/filepath"
+	"sync"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v2"
 )
 
-const (
-	dbPath      = "./tmp/blocks"
-	dbFile      = "./tmp/blocks/MANIFEST"
-	genesisData = "First Transaction from Genesis"
-)
-
 var (
+	// diretorio do banco de dados da blockchain
+	DBPath = "./tmp/blocks"
+
+	// mensagem gravada na coinbase do bloco genesis, muda de acordo com a rede
+	GenesisData = "First Transaction from Genesis"
+
 	lastHashKey = []byte("lh")
+
+	ErrChainExists       = errors.New("blockchain already exists")
+	ErrChainNotFound     = errors.New("blockchain not found")
+	ErrBlockNotFound     = errors.New("block not found")
+	ErrTxNotFound        = errors.New("transaction not found")
+	ErrInsufficientFunds = errors.New("not enough funds")
+	ErrBlockExists       = errors.New("block already exists")
+	ErrOrphanBlock       = errors.New("block parent is unknown")
+	ErrNotOnTip          = errors.New("block does not extend the chain tip")
+	ErrInvalidBlock      = errors.New("invalid block")
 )
 
 type BlockChain struct {
-	lasHash []byte
-	db      *badger.DB
+	mu         sync.RWMutex
+	lasHash    []byte
+	lastHeight int
+	db         *badger.DB
+
+	// serializa a gravação de blocos e as reorganizações
+	chainMu sync.Mutex
+	// serializa a entrada de transações no mempool
+	mempoolMu sync.Mutex
+
+	// opções usadas para minerar os novos blocos
+	Mining MiningOptions
 }
 
-func InitBlockChain(address string) *BlockChain {
-	var lastHash []byte
-
+func InitBlockChain(address string) (*BlockChain, error) {
 	if DbExists() {
-		fmt.Println("Blockchain already exists")
-		runtime.Goexit()
+		return nil, ErrChainExists
 	}
 
-	options := badger.DefaultOptions(dbPath)
+	coinbaseTx, err := CoinbaseTx(address, GenesisData, Subsidy(0))
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := badger.Open(options)
-	utils.HandleError(err)
+	genesis, err := Genesis(coinbaseTx)
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Update(func(txn *badger.Txn) error {
+	if err := os.MkdirAll(DBPath, 0755); err != nil {
+		return nil, err
+	}
 
-		fmt.Println("Blockchain not found")
-		fmt.Println("Creating Genesis...")
+	options := badger.DefaultOptions(DBPath)
 
-		coinbaseTx := CoinbaseTx(address, genesisData)
-		genesis := Genesis(coinbaseTx)
-		err := txn.Set(genesis.Hash, genesis.Serialize())
-		utils.HandleError(err)
+	db, err := badger.Open(options)
+	if err != nil {
+		return nil, err
+	}
 
-		fmt.Println("Genesis created")
+	err = db.Update(func(txn *badger.Txn) error {
+		if err := saveBlock(txn, genesis, BlockWork(genesis.Bits)); err != nil {
+			return err
+		}
+		if err := txn.Set(txIndexKey, []byte{1}); err != nil {
+			return err
+		}
+		return connectBlock(txn, genesis)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-		err = txn.Set(lastHashKey, genesis.Hash)
+	return &BlockChain{lasHash: genesis.Hash, db: db, Mining: DefaultMiningOptions}, nil
+}
 
-		lastHash = genesis.Hash
+func ContinueBlockChain(address string) (*BlockChain, error) {
+	if !DbExists() {
+		return nil, ErrChainNotFound
+	}
 
-		return err
-	})
+	chain, err := OpenBlockChain(DBPath)
+	if err != nil {
+		return nil, err
+	}
 
-	utils.HandleError(err)
+	if len(chain.LastHash()) == 0 {
+		chain.Close()
+		return nil, ErrChainNotFound
+	}
 
-	return &BlockChain{lastHash, db}
+	return chain, nil
 }
 
-func ContinueBlockChain(address string) *BlockChain {
+// abre a blockchain no diretorio informado, criando um banco vazio caso
+// ele não exista, assim um nó pode receber o genesis de outro nó
+func OpenBlockChain(path string) (*BlockChain, error) {
+	var lastHash []byte
 
-	if !DbExists() {
-		fmt.Println("BlockChain not found")
-		runtime.Goexit()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
 	}
 
-	var lastHash []byte
-
-	options := badger.DefaultOptions(dbPath)
+	options := badger.DefaultOptions(path)
 
 	db, err := badger.Open(options)
-	utils.HandleError(err)
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Update(func(txn *badger.Txn) error {
+	err = db.View(func(txn *badger.Txn) error {
 
 		item, err := txn.Get(lastHashKey)
-		utils.HandleError(err)
-
-		err = item.Value(func(lh []byte) error {
-			lastHash = lh
+		if err == badger.ErrKeyNotFound {
 			return nil
-		})
+		}
+		if err != nil {
+			return err
+		}
 
+		lastHash, err = item.ValueCopy(nil)
 		return err
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	chain := &BlockChain{lasHash: lastHash, lastHeight: -1, db: db, Mining: DefaultMiningOptions}
 
-	utils.HandleError(err)
+	if len(lastHash) > 0 {
+		lastBlock, err := chain.GetBlock(lastHash)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		chain.lastHeight = lastBlock.Height
+
+		// blockchains criadas antes do indice de trabalho acumulado
+		if _, err := chain.ChainWork(lastHash); err == badger.ErrKeyNotFound {
+			err = chain.indexChain()
+			if err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+	}
+
+	// blockchains criadas antes do indice de transações
+	indexed, err := chain.hasTransactionIndex()
+	if err == nil && !indexed {
+		err = chain.reindexTransactions()
+	}
+	if err == nil {
+		err = chain.recoverReorg()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	return &BlockChain{lastHash, db}
+	return chain, nil
 }
 
-func (bc *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
-	var unspentTxs []Transaction
+// retorna o hash do ultimo bloco, ou nil se a blockchain estiver vazia
+func (bc *BlockChain) LastHash() []byte {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
+	return bc.lasHash
+}
+
+// percorre toda a blockchain e retorna os outputs não gastos de cada transação
+func (bc *BlockChain) FindAllUTXO() (map[string]TxOutputs, error) {
+	UTXO := make(map[string]TxOutputs)
 	spentTXOs := make(map[string][]int)
 
 	it := bc.Iterator()
 
 	for {
-		block := it.Next()
+		block, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
 
 		// percorre todas as transações,
 		// começando do ultimo block minerado
@@ -114,47 +210,31 @@ func (bc *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
-			// percorre todos os outputs de uma transação
 			for outIndex, out := range tx.Outputs {
-				// verifica se há indexes de Outpus no MAP
-				// com ID desta transação
-				if spentTXOs[txID] != nil {
-
-					// percorre todos os Indexes de Outputs no MAP
-					// com o ID desta transação
-					for _, spentOut := range spentTXOs[txID] {
-						// Se o Index do Output desta transação
-						// existe no Map
-						if spentOut == outIndex {
-							// força o loop a pular para o próximo Output
-							continue Outputs
-						}
+				if out.IsUnspendable() {
+					continue
+				}
+
+				// pula os outputs que ja foram gastos
+				// por transações mais recentes
+				for _, spentOut := range spentTXOs[txID] {
+					if spentOut == outIndex {
+						continue Outputs
 					}
 				}
 
-				// se a chave publica deste output
-				// apontar para este endereço
-				// significa que o saldo ainda partence a ele
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTxs = append(unspentTxs, *tx)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TxOutputs{Outputs: make(map[int]TxOutput)}
+					UTXO[txID] = outs
 				}
+				outs.Outputs[outIndex] = out
 			}
 
-			// se a transação não for uma Coinbase Transaction
 			if !tx.IsCoinbase() {
-				// percorre todos os Inputs da transação
 				for _, in := range tx.Inputs {
-					// se a Assinatura do input apontar para
-					// este endereço significa que ele
-					// ja que o Input ja foi gasto
-					if in.UsesKey(pubKeyHash) {
-						// o ID de um Input é Igual ao ID da Transação anterior
-						inTxID := hex.EncodeToString(in.ID)
-
-						// adiciona o Index do Output na transação anterior
-						// ao MAP
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
 				}
 			}
 		}
@@ -164,122 +244,357 @@ func (bc *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
 		}
 	}
 
-	return unspentTxs
+	return UTXO, nil
 }
 
-func (bc *BlockChain) FindUTXO(pubKeyHash []byte) []TxOutput {
-	var UTXOs []TxOutput
+// percorre toda a blockchain e retorna os hashes das chaves publicas que
+// ja receberam algum output, usado para restaurar carteiras HD
+func (bc *BlockChain) FindUsedPublicKeyHashes() (map[string]bool, error) {
+	used := make(map[string]bool)
 
-	unspentTransactions := bc.FindUnspentTransactions(pubKeyHash)
+	if len(bc.LastHash()) == 0 {
+		return used, nil
+	}
+
+	it := bc.Iterator()
+	for {
+		block, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
 
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				used[hex.EncodeToString(out.AddressHash())] = true
 			}
 		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
 	}
 
-	return UTXOs
+	return used, nil
 }
 
-// retorna o saldo suficiente de uma carteira para ser usado em uma transação
-func (bc *BlockChain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-	unspentTxs := bc.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
+// minera um bloco com as transações e uma coinbase que paga ao minerador
+// a recompensa do bloco somada as taxas das transações
+func (bc *BlockChain) MineBlock(ctx context.Context, miner string, transactions []*Transaction) (*Block, error) {
+	height := bc.GetBestHeight() + 1
 
-Work:
-	for _, tx := range unspentTxs {
-		txID := hex.EncodeToString(tx.ID)
+	fees, err := bc.validateTransactions(transactions, height, true)
+	if err != nil {
+		return nil, err
+	}
 
-		for outIndex, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIndex)
+	coinbaseTx, err := CoinbaseTx(miner, "", Subsidy(height)+fees)
+	if err != nil {
+		return nil, err
+	}
 
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
+	return bc.AddBlockContext(ctx, append([]*Transaction{coinbaseTx}, transactions...))
+}
+
+func (bc *BlockChain) AddBlock(transactions []*Transaction) (*Block, error) {
+	return bc.AddBlockContext(context.Background(), transactions)
+}
+
+// valida e minera um novo bloco com as transações, a mineração é
+// interrompida e o bloco descartado quando o ctx é cancelado
+func (bc *BlockChain) AddBlockContext(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	lastHash := bc.LastHash()
+
+	lastBlock, err := bc.GetBlock(lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bc.ValidateTransactions(transactions, lastBlock.Height+1); err != nil {
+		return nil, err
+	}
+
+	bits, err := bc.RequiredBits(lastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// o timestamp deve ser maior que o tempo mediano dos blocos anteriores
+	pastTime, err := bc.branchMedianTime(lastBlock)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().Unix()
+	if timestamp <= pastTime {
+		timestamp = pastTime + 1
 	}
 
-	return accumulated, unspentOuts
+	newBlock, err := CreateBlock(ctx, transactions, lastHash, lastBlock.Height+1, timestamp, bits, bc.Mining)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bc.storeBlock(newBlock); err != nil {
+		return nil, err
+	}
+
+	return newBlock, nil
 }
 
-func (bc *BlockChain) AddBlock(transactions []*Transaction) {
-	var lastHash []byte
+// valida e adiciona um bloco minerado por outro nó, blocos de ramos
+// paralelos também são guardados e a blockchain principal passa a ser
+// o ramo com mais trabalho acumulado
+func (bc *BlockChain) AcceptBlock(block *Block) error {
+	bc.chainMu.Lock()
+	defer bc.chainMu.Unlock()
 
-	err := bc.db.View(func(txn *badger.Txn) error {
+	if bc.HasBlock(block.Hash) {
+		return ErrBlockExists
+	}
 
-		item, err := txn.Get(lastHashKey)
-		utils.HandleError(err)
+	height := 0
+	parentWork := new(big.Int)
+	var pastTime int64
 
-		err = item.Value(func(lh []byte) error {
-			lastHash = lh
-			return nil
-		})
+	if len(block.PrevHash) > 0 {
+		parent, err := bc.GetBlock(block.PrevHash)
+		if err != nil {
+			return ErrOrphanBlock
+		}
+		if bc.isInvalid(parent.Hash) {
+			return fmt.Errorf("%w: parent block %x is invalid", ErrInvalidBlock, parent.Hash)
+		}
+		if err := checkBlockVersion(block, parent); err != nil {
+			return err
+		}
+
+		height = parent.Height + 1
+
+		parentWork, err = bc.ChainWork(parent.Hash)
+		if err != nil {
+			return err
+		}
+
+		if pastTime, err = bc.branchMedianTime(parent); err != nil {
+			return err
+		}
+	} else if len(bc.LastHash()) > 0 {
+		return fmt.Errorf("%w: genesis block already exists", ErrInvalidBlock)
+	}
+
+	if block.Height != height {
+		return fmt.Errorf("%w: height %d, expected %d", ErrInvalidBlock, block.Height, height)
+	}
+
+	if err := checkBlockTime(block, pastTime, time.Now()); err != nil {
 		return err
-	})
-	utils.HandleError(err)
+	}
 
-	newBlock := CreateBlock(transactions, lastHash)
+	pow, err := bc.ProofOfWork(block)
+	if err != nil {
+		return err
+	}
+	if !pow.Validate() {
+		return fmt.Errorf("%w: invalid proof of work", ErrInvalidBlock)
+	}
+
+	if err := checkBlock(block); err != nil {
+		return err
+	}
 
+	work := new(big.Int).Add(parentWork, BlockWork(block.Bits))
+
+	if bytes.Equal(block.PrevHash, bc.LastHash()) {
+		if err := bc.ValidateTransactions(block.Transactions, block.Height); err != nil {
+			return err
+		}
+		return bc.connectTip(block, work)
+	}
+
+	// as transações de um ramo paralelo só são validadas quando ele
+	// se torna a blockchain principal
 	err = bc.db.Update(func(txn *badger.Txn) error {
+		return saveBlock(txn, block, work)
+	})
+	if err != nil {
+		return err
+	}
+
+	tipWork, err := bc.ChainWork(bc.LastHash())
+	if err != nil {
+		return err
+	}
 
-		err = txn.Set(newBlock.Hash, newBlock.Serialize())
-		utils.HandleError(err)
+	if work.Cmp(tipWork) <= 0 {
+		return nil
+	}
+
+	return bc.reorganize(block)
+}
+
+// grava o bloco minerado como novo topo da blockchain
+func (bc *BlockChain) storeBlock(block *Block) error {
+	bc.chainMu.Lock()
+	defer bc.chainMu.Unlock()
+
+	// outro bloco pode ter sido adicionado enquanto este era minerado
+	if !bytes.Equal(block.PrevHash, bc.LastHash()) {
+		return ErrNotOnTip
+	}
 
-		err = txn.Set(lastHashKey, newBlock.Hash)
+	parentWork, err := bc.ChainWork(block.PrevHash)
+	if err != nil {
 		return err
+	}
+
+	return bc.connectTip(block, parentWork.Add(parentWork, BlockWork(block.Bits)))
+}
+
+// grava o bloco que estende o topo, atualizando o UTXO set e o mempool
+func (bc *BlockChain) connectTip(block *Block, work *big.Int) error {
+	err := bc.db.Update(func(txn *badger.Txn) error {
+		if err := saveBlock(txn, block, work); err != nil {
+			return err
+		}
+		return connectBlock(txn, block)
 	})
-	utils.HandleError(err)
+	if err != nil {
+		return err
+	}
 
-	bc.lasHash = newBlock.Hash
+	bc.setLastHash(block.Hash, block.Height)
+	return nil
 }
 
-func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+func (bc *BlockChain) HasBlock(hash []byte) bool {
+	if len(hash) == 0 {
+		return false
+	}
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(hash)
+		return err
+	})
+
+	return err == nil
+}
+
+// retorna os hashes de todos os blocos, do ultimo até o genesis
+func (bc *BlockChain) GetBlockHashes() ([][]byte, error) {
+	var hashes [][]byte
+
+	if len(bc.LastHash()) == 0 {
+		return hashes, nil
+	}
+
 	it := bc.Iterator()
 	for {
-		block := it.Next()
-
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
+		block, err := it.Next()
+		if err != nil {
+			return nil, err
 		}
+		hashes = append(hashes, block.Hash)
 
 		if len(block.PrevHash) == 0 {
 			break
 		}
 	}
 
-	return Transaction{}, errors.New("Transaction does not exist")
+	return hashes, nil
+}
+
+// retorna a altura do ultimo bloco da blockchain, ou -1 se ela estiver vazia
+func (bc *BlockChain) GetBestHeight() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if len(bc.lasHash) == 0 {
+		return -1
+	}
+
+	return bc.lastHeight
+}
+
+func (bc *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(hash)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		block, err = Deserialize(encoded)
+		return err
+	})
+	if err == badger.ErrKeyNotFound || err == badger.ErrEmptyKey {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+
+	return block, err
+}
+
+func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	tx, _, err := bc.findTransaction(ID)
+	return tx, err
+}
+
+// retorna a transação e o bloco que a contém
+func (bc *BlockChain) findTransaction(ID []byte) (Transaction, *Block, error) {
+	block, err := bc.FindBlockByTransaction(ID)
+	if err != nil {
+		return Transaction{}, nil, err
+	}
+
+	for _, tx := range block.Transactions {
+		if bytes.Compare(tx.ID, ID) == 0 {
+			return *tx, block, nil
+		}
+	}
+
+	return Transaction{}, nil, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
 }
 
-func (bc *BlockChain) SignTx(tx *Transaction, privateKey ecdsa.PrivateKey) {
+// retorna o bloco da blockchain principal que contém a transação
+func (bc *BlockChain) FindBlockByTransaction(ID []byte) (*Block, error) {
+	location, err := bc.transactionLocation(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.GetBlock(location.BlockHash)
+}
+
+func (bc *BlockChain) SignTx(tx *Transaction, privateKey wallet.PrivateKey) error {
 	prevTXs := make(map[string]Transaction)
 
 	for _, input := range tx.Inputs {
 		prevTX, err := bc.FindTransaction(input.ID)
-		utils.HandleError(err)
+		if err != nil {
+			return err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privateKey, prevTXs)
+	return tx.Sign(privateKey, prevTXs)
 }
 
-func (bc *BlockChain) VerifyTx(tx *Transaction) bool {
+func (bc *BlockChain) VerifyTx(tx *Transaction) (bool, error) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, input := range tx.Inputs {
 		prevTX, err := bc.FindTransaction(input.ID)
-		utils.HandleError(err)
+		if err != nil {
+			return false, err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return tx.Verify(prevTXs)
+	return tx.Verify(prevTXs), nil
 }
 
 func (bc *BlockChain) Close() error {
@@ -287,7 +602,7 @@ func (bc *BlockChain) Close() error {
 }
 
 func DbExists() bool {
-	_, err := os.Stat(dbFile)
+	_, err := os.Stat(filepath.Join(DBPath, "MANIFEST"))
 
 	return !os.IsNotExist(err)
 }
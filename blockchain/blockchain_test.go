@@ -0,0 +1,178 @@
+package blockchain
+
+import (
+	"blockchain-tutorial/wallet"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// os testes usam uma dificuldade baixa para minerar os blocos rapidamente
+func TestMain(m *testing.M) {
+	InitialDifficulty = 8
+	os.Exit(m.Run())
+}
+
+type testKey struct {
+	PrivateKey wallet.PrivateKey
+	Address    string
+}
+
+func newTestKey(t *testing.T) testKey {
+	privateKey, publicKey, err := wallet.NewKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{privateKey, string(wallet.Wallet{PublicKey: publicKey}.Address())}
+}
+
+// cria uma blockchain em um diretorio temporario com o genesis pago a owner,
+// a função retornada fecha a blockchain e apaga o diretorio
+func newTestChain(t *testing.T, owner testKey) (*BlockChain, func()) {
+	dir, err := ioutil.TempDir("", "blockchain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := DBPath
+	DBPath = filepath.Join(dir, "blocks")
+	defer func() { DBPath = dbPath }()
+
+	chain, err := InitBlockChain(owner.Address)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return chain, func() {
+		chain.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// minera um bloco sobre parent, que não precisa ser o topo, com uma
+// coinbase paga a miner seguida das transações informadas
+func mineTestBlock(t *testing.T, chain *BlockChain, parent *Block, miner string, txs ...*Transaction) *Block {
+	coinbaseTx, err := CoinbaseTx(miner, "", Subsidy(parent.Height+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mineTestBlockWith(t, chain, parent, append([]*Transaction{coinbaseTx}, txs...))
+}
+
+// minera um bloco sobre parent com exatamente as transações informadas
+func mineTestBlockWith(t *testing.T, chain *BlockChain, parent *Block, txs []*Transaction) *Block {
+	bits, err := chain.RequiredBits(parent.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pastTime, err := chain.branchMedianTime(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Now().Unix()
+	if timestamp <= pastTime {
+		timestamp = pastTime + 1
+	}
+
+	block, err := CreateBlock(context.Background(), txs, parent.Hash, parent.Height+1, timestamp, bits, DefaultMiningOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func lastBlock(t *testing.T, chain *BlockChain) *Block {
+	block, err := chain.GetBlock(chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// cria e assina uma transação de from para to com os outputs da blockchain principal
+func newTestTx(t *testing.T, chain *BlockChain, from testKey, to string, amount, fee int) *Transaction {
+	ptx, err := NewPartialTransaction(from.Address, to, amount, fee, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.Sign(from.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	return &ptx.Transaction
+}
+
+// copia o bloco pela serialização, assim a copia pode ser alterada
+func copyBlock(t *testing.T, block *Block) *Block {
+	encoded, err := block.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := Deserialize(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return copied
+}
+
+// saldo da chave no UTXO set
+func balance(t *testing.T, chain *BlockChain, key testKey) int {
+	pubKeyHash, err := wallet.PublicKeyHashFromAddress(key.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	UTXOs, err := UTXOSet{chain}.FindUTXO(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, out := range UTXOs {
+		total += out.Value
+	}
+	return total
+}
+
+// o UTXO set deve ter exatamente os outputs não gastos da blockchain principal
+func checkUTXOSet(t *testing.T, chain *BlockChain) {
+	t.Helper()
+
+	expected := make(map[string]int)
+	UTXO, err := chain.FindAllUTXO()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for txID, outs := range UTXO {
+		for index, out := range outs.Outputs {
+			expected[fmt.Sprintf("%s:%d", txID, index)] = out.Value
+		}
+	}
+
+	found := make(map[string]int)
+	err = UTXOSet{chain}.forEach(func(txID []byte, outs TxOutputs) bool {
+		for index, out := range outs.Outputs {
+			found[outpoint(txID, index)] = out.Value
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != len(expected) {
+		t.Fatalf("UTXO set has %d outputs, the chain has %d", len(found), len(expected))
+	}
+	for outpoint, value := range expected {
+		if found[outpoint] != value {
+			t.Fatalf("output %s has value %d in the UTXO set, want %d", outpoint, found[outpoint], value)
+		}
+	}
+}
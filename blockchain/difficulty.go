@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"math/big"
+	"time"
+)
+
+var (
+	// dificuldade do bloco genesis, em bits zero a esquerda
+	InitialDifficulty = 14
+
+	// menor dificuldade permitida, define o maior Target possível
+	MinDifficulty = 1
+
+	// quantidade de blocos entre cada ajuste de dificuldade
+	RetargetInterval = 10
+
+	// tempo esperado entre dois blocos
+	TargetBlockTime = 10 * time.Second
+
+	// quanto o timestamp de um bloco pode estar a frente do relogio do nó
+	MaxFutureBlockTime = 2 * time.Hour
+)
+
+func powLimit() *big.Int {
+	limit := big.NewInt(1)
+	return limit.Lsh(limit, uint(256-MinDifficulty))
+}
+
+// calcula o novo Bits a partir do tempo que a rede levou para minerar
+// os ultimos blocos, como no bitcoin o ajuste é limitado a 4x para cima ou para baixo
+func CalculateNextBits(lastBits uint32, firstTimestamp, lastTimestamp int64, blocks int) uint32 {
+	expected := int64(blocks) * int64(TargetBlockTime/time.Second)
+	if expected <= 0 {
+		return lastBits
+	}
+
+	actual := lastTimestamp - firstTimestamp
+	if actual < expected/4 {
+		actual = expected / 4
+	}
+	if actual > expected*4 {
+		actual = expected * 4
+	}
+
+	target := CompactToBig(lastBits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+
+	if target.Cmp(powLimit()) > 0 {
+		target = powLimit()
+	}
+
+	return BigToCompact(target)
+}
+
+// retorna o Bits que a blockchain espera para o bloco seguinte a prevHash
+func (bc *BlockChain) RequiredBits(prevHash []byte) (uint32, error) {
+	if len(prevHash) == 0 {
+		return DifficultyToBits(InitialDifficulty), nil
+	}
+
+	prev, err := bc.GetBlock(prevHash)
+	if err != nil {
+		return 0, err
+	}
+
+	height := prev.Height + 1
+	if RetargetInterval <= 0 || height%RetargetInterval != 0 {
+		return prev.Bits, nil
+	}
+
+	// volta até o primeiro bloco da janela de ajuste
+	first := prev
+	for first.Height > height-RetargetInterval && len(first.PrevHash) > 0 {
+		first, err = bc.GetBlock(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return CalculateNextBits(prev.Bits, first.Timestamp, prev.Timestamp, prev.Height-first.Height), nil
+}
+
+// cria a prova de trabalho com o Target esperado pela blockchain,
+// e não com o Bits informado pelo proprio bloco
+func (bc *BlockChain) ProofOfWork(block *Block) (*ProofOfWork, error) {
+	bits, err := bc.RequiredBits(block.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProofOfWork{Block: block, Target: CompactToBig(bits)}, nil
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCalculateNextBits(t *testing.T) {
+	bits := DifficultyToBits(20)
+	target := CompactToBig(bits)
+
+	scaled := func(mul, div int64) uint32 {
+		scaled := new(big.Int).Mul(target, big.NewInt(mul))
+		return BigToCompact(scaled.Div(scaled, big.NewInt(div)))
+	}
+
+	// 10 blocos de 10 segundos, 100 segundos esperados
+	blocks := 10
+	expected := int64(blocks) * int64(TargetBlockTime/time.Second)
+
+	tests := []struct {
+		name     string
+		lastBits uint32
+		actual   int64
+		blocks   int
+		want     uint32
+	}{
+		{"on time", bits, expected, blocks, bits},
+		{"fast", bits, expected / 2, blocks, scaled(1, 2)},
+		{"slow", bits, expected * 2, blocks, scaled(2, 1)},
+		{"clamped fast", bits, expected / 10, blocks, scaled(1, 4)},
+		{"clamped fast, timestamps going back", bits, -expected, blocks, scaled(1, 4)},
+		{"clamped slow", bits, expected * 10, blocks, scaled(4, 1)},
+		{"clamped to the pow limit", DifficultyToBits(MinDifficulty), expected * 4, blocks, BigToCompact(powLimit())},
+		{"no blocks", bits, expected, 0, bits},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := int64(1600000000)
+			got := CalculateNextBits(test.lastBits, first, first+test.actual, test.blocks)
+			if got != test.want {
+				t.Errorf("CalculateNextBits = %08x, want %08x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckBlockTime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	pastTime := now.Add(-time.Hour).Unix()
+	future := now.Add(MaxFutureBlockTime).Unix()
+
+	tests := []struct {
+		name      string
+		version   int
+		prevHash  []byte
+		timestamp int64
+		valid     bool
+	}{
+		{"after the median time", BlockVersion, []byte{1}, pastTime + 1, true},
+		{"at the median time", BlockVersion, []byte{1}, pastTime, false},
+		{"before the median time", BlockVersion, []byte{1}, pastTime - 600, false},
+		{"legacy before the median time", legacyBlockVersion, []byte{1}, pastTime - 600, true},
+		{"genesis", BlockVersion, nil, 0, true},
+		{"at the future limit", BlockVersion, []byte{1}, future, true},
+		{"after the future limit", BlockVersion, []byte{1}, future + 1, false},
+		{"legacy after the future limit", legacyBlockVersion, []byte{1}, future + 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := &Block{BlockHeader: BlockHeader{
+				Version:   test.version,
+				PrevHash:  test.prevHash,
+				Timestamp: test.timestamp,
+			}}
+
+			err := checkBlockTime(block, pastTime, now)
+			if test.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("block was accepted")
+			}
+		})
+	}
+}
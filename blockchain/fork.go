@@ -0,0 +1,656 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var (
+	// trabalho acumulado do genesis até o bloco
+	workPrefix = []byte("work-")
+	// blocos sem filhos, um por ramo conhecido
+	tipPrefix = []byte("tip-")
+	// altura -> hash dos blocos da blockchain principal
+	heightPrefix = []byte("height-")
+	// outputs gastos por cada bloco, usados para desfazer o bloco no UTXO set
+	undoPrefix = []byte("undo-")
+	// blocos cujas transações foram rejeitadas durante uma reorganização, veja rejectBlock
+	invalidPrefix = []byte("invalid-")
+	// topo anterior a uma reorganização em andamento, veja recoverReorg
+	reorgKey = []byte("reorg")
+
+	ErrMissingUndo = errors.New("undo data not found")
+)
+
+const (
+	TipActive  = "active"
+	TipFork    = "fork"
+	TipInvalid = "invalid"
+)
+
+// ChainTip é o ultimo bloco de um ramo da blockchain
+type ChainTip struct {
+	Height int
+	Hash   []byte
+	// quantidade de blocos desde o ponto em que o ramo saiu da blockchain principal
+	BranchLen int
+	Status    string
+}
+
+func (t ChainTip) String() string {
+	return fmt.Sprintf("%-7s height %d, branch length %d, %x", t.Status, t.Height, t.BranchLen, t.Hash)
+}
+
+// blockUndo guarda os outputs que um bloco gastou, indexados pelo outpoint
+type blockUndo struct {
+	Spent map[string]TxOutput
+}
+
+func prefixedKey(prefix, key []byte) []byte {
+	return append(append([]byte{}, prefix...), key...)
+}
+
+func heightKey(height int) []byte {
+	return prefixedKey(heightPrefix, Int64ToHex(int64(height)))
+}
+
+func (u blockUndo) serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(u); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func deserializeUndo(data []byte) (blockUndo, error) {
+	var undo blockUndo
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&undo)
+	return undo, err
+}
+
+// trabalho esperado para encontrar um bloco com o Bits informado,
+// como no bitcoin é 2^256 / (Target + 1)
+func BlockWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	work := big.NewInt(1)
+	work.Lsh(work, 256)
+	return work.Div(work, target.Add(target, big.NewInt(1)))
+}
+
+// retorna o trabalho acumulado do genesis até o bloco
+func (bc *BlockChain) ChainWork(hash []byte) (*big.Int, error) {
+	work := new(big.Int)
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(prefixedKey(workPrefix, hash))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		work.SetBytes(encoded)
+		return nil
+	})
+
+	return work, err
+}
+
+// retorna o hash do bloco da blockchain principal na altura informada
+func (bc *BlockChain) GetBlockHash(height int) ([]byte, error) {
+	var hash []byte
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(heightKey(height))
+		if err != nil {
+			return err
+		}
+
+		hash, err = item.ValueCopy(nil)
+		return err
+	})
+
+	return hash, err
+}
+
+func (bc *BlockChain) isInvalid(hash []byte) bool {
+	err := bc.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(prefixedKey(invalidPrefix, hash))
+		return err
+	})
+
+	return err == nil
+}
+
+// grava o bloco e seu trabalho acumulado, sem altera-lo na blockchain principal
+func saveBlock(txn *badger.Txn, block *Block, work *big.Int) error {
+	encoded, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Set(block.Hash, encoded); err != nil {
+		return err
+	}
+
+	if err := txn.Set(prefixedKey(workPrefix, block.Hash), work.Bytes()); err != nil {
+		return err
+	}
+
+	if len(block.PrevHash) > 0 {
+		if err := txn.Delete(prefixedKey(tipPrefix, block.PrevHash)); err != nil {
+			return err
+		}
+	}
+
+	return txn.Set(prefixedKey(tipPrefix, block.Hash), block.Hash)
+}
+
+// torna o bloco o novo topo da blockchain principal
+func connectBlock(txn *badger.Txn, block *Block) error {
+	if err := txn.Set(heightKey(block.Height), block.Hash); err != nil {
+		return err
+	}
+
+	if err := txn.Set(lastHashKey, block.Hash); err != nil {
+		return err
+	}
+
+	if err := updateUTXO(txn, block); err != nil {
+		return err
+	}
+
+	if err := indexTransactions(txn, block); err != nil {
+		return err
+	}
+
+	return removeMempoolConflicts(txn, block)
+}
+
+// remove o topo da blockchain principal, devolvendo ao UTXO set
+// os outputs que ele gastou
+func disconnectBlock(txn *badger.Txn, block *Block) error {
+	item, err := txn.Get(prefixedKey(undoPrefix, block.Hash))
+	if err == badger.ErrKeyNotFound {
+		return fmt.Errorf("%w for block %x", ErrMissingUndo, block.Hash)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	undo, err := deserializeUndo(encoded)
+	if err != nil {
+		return err
+	}
+
+	// desfaz as transações da ultima para a primeira, assim os outputs
+	// gastos dentro do proprio bloco são restaurados corretamente
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+
+		if err := txn.Delete(utxoKey(tx.ID)); err != nil {
+			return err
+		}
+
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Inputs {
+			out, ok := undo.Spent[outpoint(in.ID, in.Out)]
+			if !ok {
+				return fmt.Errorf("%w for input %x:%d", ErrMissingUndo, in.ID, in.Out)
+			}
+
+			outs := TxOutputs{Outputs: make(map[int]TxOutput)}
+
+			item, err := txn.Get(utxoKey(in.ID))
+			if err == nil {
+				encoded, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if outs, err = DeserializeOutputs(encoded); err != nil {
+					return err
+				}
+			} else if err != badger.ErrKeyNotFound {
+				return err
+			}
+
+			outs.Outputs[in.Out] = out
+			if err := setOutputs(txn, in.ID, outs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := unindexTransactions(txn, block); err != nil {
+		return err
+	}
+
+	if err := txn.Delete(heightKey(block.Height)); err != nil {
+		return err
+	}
+
+	return txn.Set(lastHashKey, block.PrevHash)
+}
+
+func (bc *BlockChain) setLastHash(hash []byte, height int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.lasHash = hash
+	bc.lastHeight = height
+}
+
+func (bc *BlockChain) connect(block *Block) error {
+	err := bc.db.Update(func(txn *badger.Txn) error {
+		return connectBlock(txn, block)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.setLastHash(block.Hash, block.Height)
+	return nil
+}
+
+func (bc *BlockChain) disconnect(block *Block) error {
+	err := bc.db.Update(func(txn *badger.Txn) error {
+		return disconnectBlock(txn, block)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.setLastHash(block.PrevHash, block.Height-1)
+	return nil
+}
+
+// retorna os blocos que saem da blockchain principal e os que entram nela,
+// ambos do topo até o ponto de bifurcação
+func (bc *BlockChain) findFork(tip *Block) ([]*Block, []*Block, error) {
+	var detach, attach []*Block
+
+	current, err := bc.GetBlock(bc.LastHash())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for current.Height > tip.Height {
+		detach = append(detach, current)
+		if current, err = bc.GetBlock(current.PrevHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for tip.Height > current.Height {
+		attach = append(attach, tip)
+		if tip, err = bc.GetBlock(tip.PrevHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for !bytes.Equal(current.Hash, tip.Hash) {
+		detach = append(detach, current)
+		attach = append(attach, tip)
+
+		if current, err = bc.GetBlock(current.PrevHash); err != nil {
+			return nil, nil, err
+		}
+		if tip, err = bc.GetBlock(tip.PrevHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return detach, attach, nil
+}
+
+// troca a blockchain principal pelo ramo que termina em tip. Cada bloco é
+// desconectado e conectado em uma transação do banco, por isso a reorganização
+// fica registrada até terminar, e se o nó parar no meio dela a blockchain é
+// recuperada ao ser aberta
+func (bc *BlockChain) reorganize(tip *Block) error {
+	lastHash := bc.LastHash()
+
+	err := bc.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(reorgKey, lastHash)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bc.switchChain(tip)
+
+	// se a volta para a blockchain anterior também falhou o registro
+	// é mantido e a recuperação é feita na proxima abertura
+	current := bc.LastHash()
+	if !bytes.Equal(current, tip.Hash) && !bytes.Equal(current, lastHash) {
+		return err
+	}
+
+	clearErr := bc.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(reorgKey)
+	})
+	if err == nil {
+		err = clearErr
+	}
+
+	return err
+}
+
+// termina uma reorganização interrompida, tornando principal o ramo
+// valido com mais trabalho acumulado
+func (bc *BlockChain) recoverReorg() error {
+	err := bc.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(reorgKey)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tips, err := bc.ChainTips()
+	if err != nil {
+		return err
+	}
+
+	bestWork, err := bc.ChainWork(bc.LastHash())
+	if err != nil {
+		return err
+	}
+
+	var best []byte
+	for _, tip := range tips {
+		if tip.Status == TipInvalid {
+			continue
+		}
+
+		work, err := bc.ChainWork(tip.Hash)
+		if err != nil {
+			return err
+		}
+		if work.Cmp(bestWork) > 0 {
+			best, bestWork = tip.Hash, work
+		}
+	}
+
+	if best == nil {
+		return bc.db.Update(func(txn *badger.Txn) error {
+			return txn.Delete(reorgKey)
+		})
+	}
+
+	tip, err := bc.GetBlock(best)
+	if err != nil {
+		return err
+	}
+
+	return bc.reorganize(tip)
+}
+
+// as transações dos blocos abandonados voltam para o mempool quando ainda são validas
+func (bc *BlockChain) switchChain(tip *Block) error {
+	detach, attach, err := bc.findFork(tip)
+	if err != nil {
+		return err
+	}
+
+	for i, block := range detach {
+		if err := bc.disconnect(block); err != nil {
+			return bc.restore(detach[:i], nil, err)
+		}
+	}
+
+	for i := len(attach) - 1; i >= 0; i-- {
+		block := attach[i]
+
+		txErr := bc.ValidateTransactions(block.Transactions, block.Height)
+		if txErr == nil {
+			err = bc.connect(block)
+		} else {
+			err = fmt.Errorf("%w: %v", ErrInvalidBlock, txErr)
+		}
+		if err == nil {
+			continue
+		}
+
+		err = bc.restore(detach, attach[i+1:], err)
+		if txErr != nil {
+			if rejectErr := bc.rejectBlock(block, txErr); rejectErr != nil {
+				return fmt.Errorf("%v, rejecting the block: %w", err, rejectErr)
+			}
+		}
+		return err
+	}
+
+	mempool := Mempool{bc}
+	for i := len(detach) - 1; i >= 0; i-- {
+		for _, tx := range detach[i].Transactions {
+			// transações que deixaram de ser validas são descartadas
+			if !tx.IsCoinbase() {
+				mempool.Add(tx)
+			}
+		}
+	}
+
+	return nil
+}
+
+// marca como invalido um bloco cujas transações falharam. O hash do bloco não
+// inclui os scripts de desbloqueio, e nos blocos antigos nem o conteudo das
+// transações, então uma falha que pode vir de uma copia alterada do bloco
+// apenas apaga o ramo, assim o bloco verdadeiro pode ser recebido de novo
+func (bc *BlockChain) rejectBlock(block *Block, cause error) error {
+	if block.Version > legacyBlockVersion && !errors.Is(cause, ErrInvalidSignature) {
+		return bc.db.Update(func(txn *badger.Txn) error {
+			return txn.Set(prefixedKey(invalidPrefix, block.Hash), block.Hash)
+		})
+	}
+
+	return bc.discardBlock(block)
+}
+
+// apaga um bloco que não esta na blockchain principal e os blocos guardados que
+// descendem dele. O pai volta a ser um topo quando não sobra nenhum filho dele
+func (bc *BlockChain) discardBlock(block *Block) error {
+	tips, err := bc.tipHashes()
+	if err != nil {
+		return err
+	}
+
+	discard := [][]byte{block.Hash}
+	hasChildren := false
+
+	for _, hash := range tips {
+		current, err := bc.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+
+		var branch [][]byte
+		for current.Height > block.Height {
+			branch = append(branch, current.Hash)
+			if current, err = bc.GetBlock(current.PrevHash); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case current.Height < block.Height:
+		case bytes.Equal(current.Hash, block.Hash):
+			discard = append(discard, branch...)
+		case bytes.Equal(current.PrevHash, block.PrevHash):
+			hasChildren = true
+		}
+	}
+
+	return bc.db.Update(func(txn *badger.Txn) error {
+		for _, hash := range discard {
+			for _, key := range [][]byte{hash, prefixedKey(workPrefix, hash), prefixedKey(tipPrefix, hash)} {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		if hasChildren || len(block.PrevHash) == 0 {
+			return nil
+		}
+
+		// um bloco da blockchain principal só é topo quando é o ultimo
+		main, err := bc.GetBlockHash(block.Height - 1)
+		if err == nil && bytes.Equal(main, block.PrevHash) && !bytes.Equal(block.PrevHash, bc.LastHash()) {
+			return nil
+		}
+
+		return txn.Set(prefixedKey(tipPrefix, block.PrevHash), block.PrevHash)
+	})
+}
+
+// volta para a blockchain anterior a uma reorganização que falhou
+// e retorna o erro que causou a falha
+func (bc *BlockChain) restore(detached, attached []*Block, cause error) error {
+	for _, block := range attached {
+		if err := bc.disconnect(block); err != nil {
+			return fmt.Errorf("%v, restoring the previous chain: %w", cause, err)
+		}
+	}
+
+	for i := len(detached) - 1; i >= 0; i-- {
+		if err := bc.connect(detached[i]); err != nil {
+			return fmt.Errorf("%v, restoring the previous chain: %w", cause, err)
+		}
+	}
+
+	return cause
+}
+
+// retorna os hashes dos blocos sem filhos
+func (bc *BlockChain) tipHashes() ([][]byte, error) {
+	var hashes [][]byte
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(tipPrefix); it.ValidForPrefix(tipPrefix); it.Next() {
+			hash, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			hashes = append(hashes, hash)
+		}
+
+		return nil
+	})
+
+	return hashes, err
+}
+
+// retorna o ultimo bloco de cada ramo conhecido, do mais alto para o mais baixo
+func (bc *BlockChain) ChainTips() ([]ChainTip, error) {
+	hashes, err := bc.tipHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	lastHash := bc.LastHash()
+	var tips []ChainTip
+
+	for _, hash := range hashes {
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		tip := ChainTip{Height: block.Height, Hash: block.Hash, Status: TipFork}
+		if bytes.Equal(hash, lastHash) {
+			tip.Status = TipActive
+		}
+
+		// volta até encontrar um bloco da blockchain principal
+		for tip.Status != TipActive {
+			if bc.isInvalid(block.Hash) {
+				tip.Status = TipInvalid
+			}
+
+			main, err := bc.GetBlockHash(block.Height)
+			if err == nil && bytes.Equal(main, block.Hash) {
+				break
+			}
+
+			tip.BranchLen++
+			if len(block.PrevHash) == 0 {
+				break
+			}
+
+			if block, err = bc.GetBlock(block.PrevHash); err != nil {
+				return nil, err
+			}
+		}
+
+		tips = append(tips, tip)
+	}
+
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].Height != tips[j].Height {
+			return tips[i].Height > tips[j].Height
+		}
+		return tips[i].Status == TipActive
+	})
+
+	return tips, nil
+}
+
+// cria os indices de trabalho, altura e topos para uma blockchain
+// gravada antes deles existirem
+func (bc *BlockChain) indexChain() error {
+	hashes, err := bc.GetBlockHashes()
+	if err != nil {
+		return err
+	}
+
+	work := new(big.Int)
+
+	return bc.db.Update(func(txn *badger.Txn) error {
+		for i := len(hashes) - 1; i >= 0; i-- {
+			block, err := bc.GetBlock(hashes[i])
+			if err != nil {
+				return err
+			}
+
+			work = new(big.Int).Add(work, BlockWork(block.Bits))
+
+			if err := txn.Set(prefixedKey(workPrefix, block.Hash), work.Bytes()); err != nil {
+				return err
+			}
+			if err := txn.Set(heightKey(block.Height), block.Hash); err != nil {
+				return err
+			}
+		}
+
+		return txn.Set(prefixedKey(tipPrefix, hashes[0]), hashes[0])
+	})
+}
@@ -0,0 +1,260 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// um nó altera apenas o script de desbloqueio de um bloco de um ramo paralelo,
+// o hash continua o mesmo, então o bloco verdadeiro não pode ficar bloqueado
+func TestReorgWithMalleatedScript(t *testing.T) {
+	owner, miner := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	genesis := lastBlock(t, chain)
+	main := mineTestBlock(t, chain, genesis, miner.Address)
+	if err := chain.AcceptBlock(main); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := newTestTx(t, chain, owner, miner.Address, 10, 1)
+	side := mineTestBlock(t, chain, genesis, miner.Address, tx)
+
+	malleated := copyBlock(t, side)
+	in := &malleated.Transactions[1].Inputs[0]
+	in.Script = append([]byte{}, in.Script...)
+	in.Script[len(in.Script)-1] ^= 0x01
+	if !bytes.Equal(malleated.HashTransactions(), side.MerkleRoot) {
+		t.Fatal("the malleated block should keep the merkle root")
+	}
+
+	// o ramo com o bloco alterado tem mais trabalho e é rejeitado na reorganização
+	if err := chain.AcceptBlock(malleated); err != nil {
+		t.Fatal(err)
+	}
+	sideTip := mineTestBlock(t, chain, side, miner.Address)
+	if err := chain.AcceptBlock(sideTip); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("reorg to the malleated branch returned %v, want %v", err, ErrInvalidBlock)
+	}
+	if !bytes.Equal(chain.LastHash(), main.Hash) {
+		t.Fatal("the previous chain was not restored")
+	}
+	if chain.HasBlock(side.Hash) || chain.HasBlock(sideTip.Hash) || chain.isInvalid(side.Hash) {
+		t.Fatal("the malleated branch should be discarded without being marked invalid")
+	}
+
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tips) != 1 || tips[0].Status != TipActive {
+		t.Fatalf("chain tips %v, want only the active tip", tips)
+	}
+
+	// o ramo verdadeiro ainda é aceito
+	if err := chain.AcceptBlock(side); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AcceptBlock(sideTip); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash(), sideTip.Hash) {
+		t.Fatal("the honest branch did not become the main chain")
+	}
+}
+
+// o ramo com mais trabalho vira a blockchain principal, as transações do ramo
+// abandonado voltam para o mempool e saem dele quando são mineradas de novo
+func TestReorgToMoreWork(t *testing.T) {
+	owner, miner, receiver := newTestKey(t), newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	mempool := Mempool{BlockChain: chain}
+	genesis := lastBlock(t, chain)
+
+	tx := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	main1 := mineTestBlock(t, chain, genesis, owner.Address, tx)
+	if err := chain.AcceptBlock(main1); err != nil {
+		t.Fatal(err)
+	}
+
+	side1 := mineTestBlock(t, chain, genesis, miner.Address)
+	if err := chain.AcceptBlock(side1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash(), main1.Hash) {
+		t.Fatal("a branch with the same work replaced the main chain")
+	}
+
+	side2 := mineTestBlock(t, chain, side1, miner.Address)
+	if err := chain.AcceptBlock(side2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash(), side2.Hash) {
+		t.Fatal("the branch with more work did not become the main chain")
+	}
+	checkUTXOSet(t, chain)
+
+	if got, want := balance(t, chain, miner), Subsidy(1)+Subsidy(2); got != want {
+		t.Errorf("miner balance %d, want %d", got, want)
+	}
+	if got, want := balance(t, chain, owner), Subsidy(0); got != want {
+		t.Errorf("owner balance %d, want %d", got, want)
+	}
+	if got := balance(t, chain, receiver); got != 0 {
+		t.Errorf("receiver balance %d, want 0", got)
+	}
+
+	if _, err := mempool.FindTransaction(tx.ID); err != nil {
+		t.Fatalf("the transaction of the abandoned block is not in the mempool: %v", err)
+	}
+
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tips) != 2 ||
+		tips[0].Status != TipActive || !bytes.Equal(tips[0].Hash, side2.Hash) || tips[0].BranchLen != 0 ||
+		tips[1].Status != TipFork || !bytes.Equal(tips[1].Hash, main1.Hash) || tips[1].BranchLen != 1 {
+		t.Fatalf("chain tips %v", tips)
+	}
+
+	// o ramo original volta a ter mais trabalho
+	main2 := mineTestBlock(t, chain, main1, owner.Address)
+	if err := chain.AcceptBlock(main2); err != nil {
+		t.Fatal(err)
+	}
+	main3 := mineTestBlock(t, chain, main2, owner.Address)
+	if err := chain.AcceptBlock(main3); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash(), main3.Hash) {
+		t.Fatal("the original branch did not become the main chain again")
+	}
+	checkUTXOSet(t, chain)
+
+	if got := balance(t, chain, receiver); got != 10 {
+		t.Errorf("receiver balance %d, want 10", got)
+	}
+	if count, err := mempool.Count(); err != nil || count != 0 {
+		t.Fatalf("mempool has %d transactions, %v, want none", count, err)
+	}
+}
+
+// uma transação invalida em um bloco do novo ramo faz a reorganização voltar
+// para a blockchain anterior e, como o hash do bloco inclui a transação, o bloco
+// é marcado como invalido
+func TestReorgRestoresAfterInvalidTransaction(t *testing.T) {
+	owner, miner, receiver := newTestKey(t), newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	genesis := lastBlock(t, chain)
+
+	// as duas transações gastam o output do genesis
+	spend := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	doubleSpend := newTestTx(t, chain, owner, miner.Address, 20, 1)
+
+	main1 := mineTestBlock(t, chain, genesis, owner.Address)
+	if err := chain.AcceptBlock(main1); err != nil {
+		t.Fatal(err)
+	}
+
+	side1 := mineTestBlock(t, chain, genesis, miner.Address, spend)
+	if err := chain.AcceptBlock(side1); err != nil {
+		t.Fatal(err)
+	}
+	side2 := mineTestBlock(t, chain, side1, miner.Address, doubleSpend)
+	if err := chain.AcceptBlock(side2); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("reorg to a branch with a double spend returned %v, want %v", err, ErrInvalidBlock)
+	}
+
+	if !bytes.Equal(chain.LastHash(), main1.Hash) || chain.GetBestHeight() != 1 {
+		t.Fatal("the previous chain was not restored")
+	}
+	checkUTXOSet(t, chain)
+
+	if got, want := balance(t, chain, owner), Subsidy(0)+Subsidy(1); got != want {
+		t.Errorf("owner balance %d, want %d", got, want)
+	}
+	if got := balance(t, chain, miner); got != 0 {
+		t.Errorf("miner balance %d, want 0", got)
+	}
+	if count, err := (Mempool{BlockChain: chain}).Count(); err != nil || count != 0 {
+		t.Fatalf("mempool has %d transactions, %v, want none", count, err)
+	}
+
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tips) != 2 ||
+		tips[0].Status != TipInvalid || !bytes.Equal(tips[0].Hash, side2.Hash) || tips[0].BranchLen != 2 ||
+		tips[1].Status != TipActive || !bytes.Equal(tips[1].Hash, main1.Hash) {
+		t.Fatalf("chain tips %v", tips)
+	}
+
+	// os descendentes do bloco invalido são rejeitados
+	side3 := mineTestBlock(t, chain, side2, miner.Address)
+	if err := chain.AcceptBlock(side3); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("block on top of an invalid block returned %v, want %v", err, ErrInvalidBlock)
+	}
+}
+
+// uma reorganização interrompida é terminada na proxima abertura,
+// seguindo o ramo valido com mais trabalho
+func TestRecoverReorg(t *testing.T) {
+	owner, miner := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	genesis := lastBlock(t, chain)
+
+	side1 := mineTestBlock(t, chain, genesis, miner.Address)
+	if err := chain.AcceptBlock(side1); err != nil {
+		t.Fatal(err)
+	}
+	main1 := mineTestBlock(t, chain, genesis, owner.Address)
+	if err := chain.AcceptBlock(main1); err != nil {
+		t.Fatal(err)
+	}
+	main2 := mineTestBlock(t, chain, main1, owner.Address)
+	if err := chain.AcceptBlock(main2); err != nil {
+		t.Fatal(err)
+	}
+
+	// simula um nó que parou no meio da reorganização, com o genesis como topo
+	err := chain.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(reorgKey, main2.Hash)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.disconnect(main2); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.disconnect(main1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chain.recoverReorg(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash(), main2.Hash) {
+		t.Fatal("the branch with more work was not restored")
+	}
+	checkUTXOSet(t, chain)
+
+	err = chain.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(reorgKey)
+		return err
+	})
+	if err != badger.ErrKeyNotFound {
+		t.Fatalf("the reorg record was not removed: %v", err)
+	}
+}
@@ -1,7 +1,7 @@
 package blockchain
 
 import (
-	"blockchain-tutorial/utils"
+	"fmt"
 
 	badger "github.com/dgraph-io/badger/v2"
 )
@@ -12,31 +12,40 @@ type BlockChainIterator struct {
 }
 
 func (bc *BlockChain) Iterator() *BlockChainIterator {
-	it := &BlockChainIterator{CurrentHash: bc.lasHash, db: bc.db}
+	it := &BlockChainIterator{CurrentHash: bc.LastHash(), db: bc.db}
 
 	return it
 }
 
-func (bci *BlockChainIterator) Next() *Block {
+func (bci *BlockChainIterator) Next() (*Block, error) {
 	var block *Block
 
+	if len(bci.CurrentHash) == 0 {
+		return nil, ErrChainNotFound
+	}
+
 	err := bci.db.View(func(txn *badger.Txn) error {
 
 		item, err := txn.Get(bci.CurrentHash)
-		utils.HandleError(err)
+		if err != nil {
+			return err
+		}
 
-		err = item.Value(func(encodedBlock []byte) error {
-			block = Deserialize(encodedBlock)
+		return item.Value(func(encodedBlock []byte) error {
+			block, err = Deserialize(encodedBlock)
 
-			return nil
+			return err
 		})
-
-		return err
 	})
 
-	utils.HandleError(err)
+	if err == badger.ErrKeyNotFound {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, bci.CurrentHash)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	bci.CurrentHash = block.PrevHash
 
-	return block
+	return block, nil
 }
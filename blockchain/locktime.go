@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// locktimes menores que este valor são alturas de bloco, os demais timestamps unix
+	LockTimeThreshold = 500000000
+
+	// o sequence de um input trava o input até que o output gasto tenha a idade
+	// informada nos 16 bits mais baixos, em blocos ou, com SequenceTypeFlag,
+	// em unidades de 512 segundos, assim como no BIP68
+	SequenceTypeFlag    = 1 << 22
+	SequenceLockMask    = 0x0000ffff
+	sequenceGranularity = 9
+
+	// quantidade de blocos do tempo mediano, que é usado no lugar do timestamp
+	// do bloco porque o minerador não consegue adianta-lo
+	medianTimeBlocks = 11
+)
+
+var (
+	ErrNonFinal        = errors.New("transaction is not final")
+	ErrInvalidSequence = errors.New("invalid input sequence")
+)
+
+// retorna o tempo mediano dos blocos até a altura informada
+type medianTimeFunc func(height int) (int64, error)
+
+func medianTime(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+
+	sorted := append([]int64{}, timestamps...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[len(sorted)/2]
+}
+
+// tempo mediano dos ultimos 11 blocos da blockchain principal até a altura
+// informada, as alturas negativas usam o genesis
+func (bc *BlockChain) MedianTimePast(height int) (int64, error) {
+	if height < 0 {
+		height = 0
+	}
+
+	var timestamps []int64
+	for h := height; h >= 0 && h > height-medianTimeBlocks; h-- {
+		hash, err := bc.GetBlockHash(h)
+		if err != nil {
+			return 0, err
+		}
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, block.Timestamp)
+	}
+
+	return medianTime(timestamps), nil
+}
+
+// tempo mediano dos 11 blocos até prev, seguindo o ramo de prev
+// e não a blockchain principal
+func (bc *BlockChain) branchMedianTime(prev *Block) (int64, error) {
+	timestamps := []int64{prev.Timestamp}
+
+	for len(timestamps) < medianTimeBlocks && len(prev.PrevHash) > 0 {
+		var err error
+		if prev, err = bc.GetBlock(prev.PrevHash); err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, prev.Timestamp)
+	}
+
+	return medianTime(timestamps), nil
+}
+
+func formatLockTime(lockTime uint32) string {
+	if lockTime < LockTimeThreshold {
+		return fmt.Sprintf("height %d", lockTime)
+	}
+	return time.Unix(int64(lockTime), 0).UTC().Format(time.RFC3339)
+}
+
+// somente o tipo e o valor da trava podem estar presentes no sequence
+func checkSequence(sequence uint32) error {
+	if sequence&^(SequenceTypeFlag|SequenceLockMask) != 0 {
+		return fmt.Errorf("%w: %#x", ErrInvalidSequence, sequence)
+	}
+	return nil
+}
+
+// a transação entra no bloco da altura informada quando o locktime é zero ou menor
+// que a altura do bloco ou, nos timestamps, que o tempo mediano dos blocos anteriores
+func checkLockTime(tx *Transaction, height int, medianTimePast medianTimeFunc) error {
+	if tx.LockTime == 0 {
+		return nil
+	}
+
+	if tx.LockTime < LockTimeThreshold {
+		if int64(tx.LockTime) < int64(height) {
+			return nil
+		}
+	} else {
+		pastTime, err := medianTimePast(height - 1)
+		if err != nil {
+			return err
+		}
+		if int64(tx.LockTime) < pastTime {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: locked until %s", ErrNonFinal, formatLockTime(tx.LockTime))
+}
+
+// o input entra no bloco da altura informada quando o output gasto, confirmado
+// em prevHeight, tem a idade pedida no sequence
+func checkSequenceLock(sequence uint32, prevHeight, height int, medianTimePast medianTimeFunc) error {
+	value := sequence & SequenceLockMask
+	if value == 0 {
+		return nil
+	}
+
+	if sequence&SequenceTypeFlag == 0 {
+		if height-prevHeight >= int(value) {
+			return nil
+		}
+		return fmt.Errorf("%w: spent output confirmed at height %d must be %d blocks old", ErrNonFinal, prevHeight, value)
+	}
+
+	pastTime, err := medianTimePast(height - 1)
+	if err != nil {
+		return err
+	}
+	prevTime, err := medianTimePast(prevHeight - 1)
+	if err != nil {
+		return err
+	}
+
+	age := int64(value) << sequenceGranularity
+	if pastTime-prevTime >= age {
+		return nil
+	}
+	return fmt.Errorf("%w: spent output confirmed at height %d must be %s old", ErrNonFinal, prevHeight, time.Duration(age)*time.Second)
+}
@@ -0,0 +1,260 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+// tempo mediano em que cada bloco está 600 segundos depois do anterior
+func testMedianTime(height int) (int64, error) {
+	return LockTimeThreshold + 600*int64(height), nil
+}
+
+func TestMedianTime(t *testing.T) {
+	tests := []struct {
+		timestamps []int64
+		median     int64
+	}{
+		{nil, 0},
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{4, 1, 3, 2}, 3},
+		{[]int64{9, 1, 8, 2, 7, 3, 6, 4, 5, 10, 11}, 6},
+	}
+
+	for _, test := range tests {
+		if median := medianTime(test.timestamps); median != test.median {
+			t.Errorf("medianTime(%v) = %d, want %d", test.timestamps, median, test.median)
+		}
+	}
+}
+
+func TestCheckLockTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockTime uint32
+		height   int
+		err      error
+	}{
+		{"no locktime", 0, 1, nil},
+		{"height below the block", 9, 10, nil},
+		{"height of the block", 10, 10, ErrNonFinal},
+		{"height above the block", 11, 10, ErrNonFinal},
+		{"largest height", LockTimeThreshold - 1, 10, ErrNonFinal},
+
+		// o tempo mediano antes do bloco da altura 10 é LockTimeThreshold + 5400
+		{"threshold is a timestamp", LockTimeThreshold, 10, nil},
+		{"time below the median", LockTimeThreshold + 5399, 10, nil},
+		{"time of the median", LockTimeThreshold + 5400, 10, ErrNonFinal},
+		{"time above the median", LockTimeThreshold + 6000, 10, ErrNonFinal},
+	}
+
+	for _, test := range tests {
+		tx := &Transaction{LockTime: test.lockTime}
+		if err := checkLockTime(tx, test.height, testMedianTime); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestCheckSequenceLock(t *testing.T) {
+	tests := []struct {
+		name       string
+		sequence   uint32
+		prevHeight int
+		height     int
+		err        error
+	}{
+		{"no lock", 0, 10, 10, nil},
+		{"old enough", 5, 10, 15, nil},
+		{"too recent", 5, 10, 14, ErrNonFinal},
+
+		// cada bloco adiciona 600 segundos ao tempo mediano, 512 * 2 precisa de 2 blocos
+		{"time old enough", SequenceTypeFlag | 2, 10, 12, nil},
+		{"time too recent", SequenceTypeFlag | 2, 10, 11, ErrNonFinal},
+		{"time same block", SequenceTypeFlag | 1, 10, 10, ErrNonFinal},
+	}
+
+	for _, test := range tests {
+		err := checkSequenceLock(test.sequence, test.prevHeight, test.height, testMedianTime)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestCheckSequence(t *testing.T) {
+	for _, sequence := range []uint32{0, 1, SequenceLockMask, SequenceTypeFlag | SequenceLockMask} {
+		if err := checkSequence(sequence); err != nil {
+			t.Errorf("sequence %#x: %v", sequence, err)
+		}
+	}
+	for _, sequence := range []uint32{1 << 16, 1 << 31, 0xffffffff} {
+		if err := checkSequence(sequence); !errors.Is(err, ErrInvalidSequence) {
+			t.Errorf("sequence %#x returned %v, want %v", sequence, err, ErrInvalidSequence)
+		}
+	}
+}
+
+// os opcodes CLTV e CSV comparam a trava do script com a da transação
+func TestTxCheckerLocks(t *testing.T) {
+	lockTests := []struct {
+		txLockTime uint32
+		lock       int64
+		ok         bool
+	}{
+		{100, 100, true},
+		{100, 99, true},
+		{100, 101, false},
+		{LockTimeThreshold + 100, LockTimeThreshold, true},
+		{LockTimeThreshold + 100, LockTimeThreshold + 101, false},
+
+		// a trava e o locktime devem ser do mesmo tipo
+		{LockTimeThreshold, 100, false},
+		{100, LockTimeThreshold, false},
+	}
+
+	for _, test := range lockTests {
+		checker := txChecker{tx: &Transaction{LockTime: test.txLockTime, Inputs: []TxInput{{}}}}
+		if ok := checker.CheckLockTime(test.lock); ok != test.ok {
+			t.Errorf("locktime %d with lock %d: got %v, want %v", test.txLockTime, test.lock, ok, test.ok)
+		}
+	}
+
+	sequenceTests := []struct {
+		inputSequence uint32
+		lock          int64
+		ok            bool
+	}{
+		{10, 10, true},
+		{10, 9, true},
+		{10, 11, false},
+		{SequenceTypeFlag | 10, SequenceTypeFlag | 10, true},
+		{SequenceTypeFlag | 10, SequenceTypeFlag | 11, false},
+		{SequenceTypeFlag | 10, 10, false},
+		{10, SequenceTypeFlag | 10, false},
+		{10, 1 << 16, false},
+	}
+
+	for _, test := range sequenceTests {
+		checker := txChecker{tx: &Transaction{Inputs: []TxInput{{Sequence: test.inputSequence}}}}
+		if ok := checker.CheckSequence(test.lock); ok != test.ok {
+			t.Errorf("sequence %#x with lock %#x: got %v, want %v", test.inputSequence, test.lock, ok, test.ok)
+		}
+	}
+}
+
+func TestMedianTimePast(t *testing.T) {
+	owner := newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	var timestamps []int64
+	genesis := lastBlock(t, chain)
+	timestamps = append(timestamps, genesis.Timestamp)
+
+	for height := 1; height <= 13; height++ {
+		block := mineTestBlock(t, chain, lastBlock(t, chain), owner.Address)
+		if err := chain.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, block.Timestamp)
+	}
+
+	for _, height := range []int{-1, 0, 5, 10, 13} {
+		first := height - medianTimeBlocks + 1
+		if first < 0 {
+			first = 0
+		}
+		last := height
+		if last < 0 {
+			last = 0
+		}
+
+		pastTime, err := chain.MedianTimePast(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := medianTime(timestamps[first : last+1]); pastTime != want {
+			t.Errorf("MedianTimePast(%d) = %d, want %d", height, pastTime, want)
+		}
+	}
+}
+
+// as travas de tempo valem para a altura do bloco que recebe a transação
+func TestValidateLockedTransaction(t *testing.T) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	genesis := lastBlock(t, chain)
+
+	lockedTx := func(lockTime, sequence uint32) *Transaction {
+		ptx, err := NewPartialTransaction(owner.Address, receiver.Address, 10, 1, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ptx.SetLocks(lockTime, sequence); err != nil {
+			t.Fatal(err)
+		}
+		if err := ptx.Sign(owner.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		return &ptx.Transaction
+	}
+
+	for height := 1; height <= 2; height++ {
+		block := mineTestBlock(t, chain, lastBlock(t, chain), receiver.Address)
+		if err := chain.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tx     *Transaction
+		height int
+		err    error
+	}{
+		{"height lock reached", lockedTx(2, 0), 3, nil},
+		{"height lock not reached", lockedTx(3, 0), 3, ErrNonFinal},
+		{"time lock reached", lockedTx(uint32(genesis.Timestamp-1), 0), 3, nil},
+		{"time lock not reached", lockedTx(uint32(genesis.Timestamp+3600), 0), 3, ErrNonFinal},
+
+		// o genesis, que confirmou o output gasto, está na altura 0
+		{"sequence reached", lockedTx(0, 3), 3, nil},
+		{"sequence not reached", lockedTx(0, 4), 3, ErrNonFinal},
+		{"time sequence not reached", lockedTx(0, SequenceTypeFlag|8), 3, ErrNonFinal},
+	}
+
+	for _, test := range tests {
+		if err := chain.ValidateTransactions([]*Transaction{test.tx}, test.height); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	// o mempool guarda a transação travada, mas ela só é minerada depois de liberada
+	mempool := Mempool{BlockChain: chain}
+	locked := lockedTx(3, 0)
+	if err := mempool.Add(locked); err != nil {
+		t.Fatal(err)
+	}
+	unlocked, err := mempool.UnlockedTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unlocked) != 0 {
+		t.Fatal("a transaction locked until height 3 is unlocked in the block at height 3")
+	}
+
+	block := mineTestBlock(t, chain, lastBlock(t, chain), receiver.Address)
+	if err := chain.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if unlocked, err = mempool.UnlockedTransactions(); err != nil {
+		t.Fatal(err)
+	}
+	if len(unlocked) != 1 {
+		t.Fatal("the transaction is still locked in the block at height 4")
+	}
+}
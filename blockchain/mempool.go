@@ -0,0 +1,367 @@
+package blockchain
+
+import (
+	"blockchain-tutorial/script"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var (
+	mempoolPrefix = []byte("mempool-")
+
+	// quantidade maxima de transações, além da coinbase, em um bloco minerado
+	MaxBlockTransactions = 100
+
+	ErrMempoolConflict = errors.New("transaction spends an output already used by a pending transaction")
+	ErrTxInMempool     = errors.New("transaction is already in the mempool")
+	ErrMempoolCoinbase = errors.New("coinbase transactions cannot be queued")
+)
+
+// Mempool guarda no badger as transações que aguardam para serem mineradas,
+// assim elas sobrevivem entre as execuções da linha de comando
+type Mempool struct {
+	BlockChain *BlockChain
+}
+
+type mempoolEntry struct {
+	Transaction Transaction
+	Fee         int
+	Added       int64
+}
+
+func mempoolKey(txID []byte) []byte {
+	return append(append([]byte{}, mempoolPrefix...), txID...)
+}
+
+func (e mempoolEntry) serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(e); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func deserializeMempoolEntry(data []byte) (mempoolEntry, error) {
+	var entry mempoolEntry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+	return entry, err
+}
+
+func readMempool(txn *badger.Txn) ([]mempoolEntry, error) {
+	var entries []mempoolEntry
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(mempoolPrefix); it.ValidForPrefix(mempoolPrefix); it.Next() {
+		encoded, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := deserializeMempoolEntry(encoded)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// outputs gastos pelas transações pendentes
+func spentByEntries(entries []mempoolEntry) map[string]bool {
+	spent := make(map[string]bool)
+
+	for _, entry := range entries {
+		for _, in := range entry.Transaction.Inputs {
+			spent[outpoint(in.ID, in.Out)] = true
+		}
+	}
+
+	return spent
+}
+
+func (m Mempool) entries() ([]mempoolEntry, error) {
+	var entries []mempoolEntry
+
+	err := m.BlockChain.db.View(func(txn *badger.Txn) error {
+		var err error
+		entries, err = readMempool(txn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// maiores taxas primeiro, e as mais antigas em caso de empate
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Fee != entries[j].Fee {
+			return entries[i].Fee > entries[j].Fee
+		}
+		return entries[i].Added < entries[j].Added
+	})
+
+	return entries, nil
+}
+
+// retorna as transações pendentes ordenadas pela taxa
+func (m Mempool) Transactions() ([]*Transaction, error) {
+	var txs []*Transaction
+
+	entries, err := m.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		tx := entry.Transaction
+		txs = append(txs, &tx)
+	}
+
+	return txs, nil
+}
+
+// retorna a transação pendente com o ID informado, ou ErrTxNotFound
+func (m Mempool) FindTransaction(ID []byte) (*Transaction, error) {
+	var entry mempoolEntry
+
+	err := m.BlockChain.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(mempoolKey(ID))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		entry, err = deserializeMempoolEntry(encoded)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry.Transaction, nil
+}
+
+func (m Mempool) Count() (int, error) {
+	entries, err := m.entries()
+	return len(entries), err
+}
+
+// transações pendentes que não estão travadas por locktime ou sequence no proximo
+// bloco, as que deixaram de ser validas também são retornadas para serem removidas
+func (m Mempool) UnlockedTransactions() ([]*Transaction, error) {
+	pending, err := m.Transactions()
+	if err != nil {
+		return nil, err
+	}
+
+	height := m.BlockChain.GetBestHeight() + 1
+
+	var unlocked []*Transaction
+	for _, tx := range pending {
+		_, err := m.BlockChain.validateTransactions([]*Transaction{tx}, height, true)
+		if !errors.Is(err, ErrNonFinal) {
+			unlocked = append(unlocked, tx)
+		}
+	}
+
+	return unlocked, nil
+}
+
+// retorna os outputs que ja estão sendo gastos por transações pendentes
+func (m Mempool) SpentOutputs() (map[string]bool, error) {
+	entries, err := m.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return spentByEntries(entries), nil
+}
+
+// valida a transação contra o UTXO set e as demais transações pendentes
+// antes de guarda-la no mempool
+func (m Mempool) Add(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return &TxError{tx.ID, ErrMempoolCoinbase}
+	}
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return &TxError{tx.ID, ErrInvalidTxID}
+	}
+	if tx.Version < TxVersion {
+		return &TxError{tx.ID, fmt.Errorf("%w: %d", ErrTxVersion, tx.Version)}
+	}
+
+	// os blocos aceitam qualquer script, mas o mempool só repassa os padrões
+	for index, out := range tx.Outputs {
+		if class, _ := script.Extract(out.LockingScript()); class == script.NonStandard {
+			return &TxError{tx.ID, fmt.Errorf("%w: output %d", ErrNonStandard, index)}
+		}
+	}
+
+	// duas transações que gastam o mesmo output não podem ser validadas ao
+	// mesmo tempo, cada uma passaria por não ver a outra no mempool
+	m.BlockChain.mempoolMu.Lock()
+	defer m.BlockChain.mempoolMu.Unlock()
+
+	spent, err := m.SpentOutputs()
+	if err != nil {
+		return err
+	}
+
+	for _, in := range tx.Inputs {
+		if spent[outpoint(in.ID, in.Out)] {
+			return &TxError{tx.ID, ErrMempoolConflict}
+		}
+	}
+
+	// transações travadas por locktime ou sequence aguardam no mempool
+	fee, err := m.BlockChain.validateTransactions([]*Transaction{tx}, m.BlockChain.GetBestHeight()+1, false)
+	if err != nil {
+		return err
+	}
+
+	entry, err := mempoolEntry{Transaction: *tx, Fee: fee, Added: time.Now().UnixNano()}.serialize()
+	if err != nil {
+		return err
+	}
+
+	return m.BlockChain.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(mempoolKey(tx.ID)); err == nil {
+			return &TxError{tx.ID, ErrTxInMempool}
+		}
+
+		// os conflitos são verificados de novo na transação que grava a nova
+		pending, err := readMempool(txn)
+		if err != nil {
+			return err
+		}
+
+		spent := spentByEntries(pending)
+		for _, in := range tx.Inputs {
+			if spent[outpoint(in.ID, in.Out)] {
+				return &TxError{tx.ID, ErrMempoolConflict}
+			}
+		}
+
+		return txn.Set(mempoolKey(tx.ID), entry)
+	})
+}
+
+func (m Mempool) Remove(txIDs ...[]byte) error {
+	return m.BlockChain.db.Update(func(txn *badger.Txn) error {
+		for _, txID := range txIDs {
+			if err := txn.Delete(mempoolKey(txID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// remove do mempool as transações incluidas no bloco
+// e as que gastam os mesmos outputs que ele
+func removeMempoolConflicts(txn *badger.Txn, block *Block) error {
+	included := make(map[string]bool)
+	spent := make(map[string]bool)
+
+	for _, tx := range block.Transactions {
+		included[string(tx.ID)] = true
+		for _, in := range tx.Inputs {
+			spent[outpoint(in.ID, in.Out)] = true
+		}
+	}
+
+	var stale [][]byte
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	for it.Seek(mempoolPrefix); it.ValidForPrefix(mempoolPrefix); it.Next() {
+		encoded, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			it.Close()
+			return err
+		}
+
+		entry, err := deserializeMempoolEntry(encoded)
+		if err != nil {
+			it.Close()
+			return err
+		}
+
+		tx := entry.Transaction
+		conflict := included[string(tx.ID)]
+		for _, in := range tx.Inputs {
+			conflict = conflict || spent[outpoint(in.ID, in.Out)]
+		}
+
+		if conflict {
+			stale = append(stale, it.Item().KeyCopy(nil))
+		}
+	}
+	it.Close()
+
+	for _, key := range stale {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// minera um bloco com as transações pendentes de maior taxa,
+// as transações que deixaram de ser validas são removidas do mempool
+func (bc *BlockChain) MinePending(ctx context.Context, miner string) (*Block, error) {
+	mempool := Mempool{bc}
+	height := bc.GetBestHeight() + 1
+
+	var selected []*Transaction
+	var stale [][]byte
+
+	pending, err := mempool.Transactions()
+	if err != nil {
+		return nil, err
+	}
+
+	// cada transação é validada sobre as ja selecionadas
+	validator := bc.newTxValidator(height, true)
+
+	for _, tx := range pending {
+		if len(selected) >= MaxBlockTransactions {
+			break
+		}
+
+		_, err := validator.add(tx)
+		if errors.Is(err, ErrNonFinal) {
+			continue
+		}
+		if err != nil {
+			stale = append(stale, tx.ID)
+			continue
+		}
+
+		selected = append(selected, tx)
+	}
+
+	if len(stale) > 0 {
+		if err := mempool.Remove(stale...); err != nil {
+			return nil, err
+		}
+	}
+
+	return bc.MineBlock(ctx, miner, selected)
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"blockchain-tutorial/script"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// minera blocos pagos a key, criando um output para cada bloco
+func mineTestOutputs(t *testing.T, chain *BlockChain, key testKey, count int) {
+	for i := 0; i < count; i++ {
+		block := mineTestBlock(t, chain, lastBlock(t, chain), key.Address)
+		if err := chain.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMempoolAdd(t *testing.T) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	mempool := Mempool{BlockChain: chain}
+
+	// as duas transações gastam o output do genesis
+	tx := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	doubleSpend := newTestTx(t, chain, owner, owner.Address, 20, 2)
+
+	coinbase, err := CoinbaseTx(owner.Address, "", Subsidy(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changedID := *tx
+	changedID.ID = doubleSpend.ID
+
+	nonStandard := *newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	nonStandard.Outputs = append([]TxOutput{}, nonStandard.Outputs...)
+	nonStandard.Outputs[0].Script = []byte{script.OP_TRUE}
+	nonStandard.ID = nonStandard.Hash()
+
+	if err := mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		tx   *Transaction
+		err  error
+	}{
+		{"double spend", doubleSpend, ErrMempoolConflict},
+		{"coinbase", coinbase, ErrMempoolCoinbase},
+		{"ID does not match the hash", &changedID, ErrInvalidTxID},
+		{"non standard output", &nonStandard, ErrNonStandard},
+	}
+
+	for _, test := range tests {
+		err := mempool.Add(test.tx)
+		var txErr *TxError
+		if !errors.Is(err, test.err) || !errors.As(err, &txErr) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	if count, err := mempool.Count(); err != nil || count != 1 {
+		t.Fatalf("mempool has %d transactions, %v, want 1", count, err)
+	}
+
+	// a nova transação não usa o output que ja esta sendo gasto no mempool
+	if _, err := NewPartialTransaction(owner.Address, receiver.Address, 10, 1, chain); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("spending a pending output returned %v, want %v", err, ErrInsufficientFunds)
+	}
+}
+
+func TestMinePendingFeeOrder(t *testing.T) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	mempool := Mempool{BlockChain: chain}
+	mineTestOutputs(t, chain, owner, 2)
+
+	// cada transação gasta um output diferente do owner
+	var txs []*Transaction
+	for _, fee := range []int{1, 5, 3} {
+		tx := newTestTx(t, chain, owner, receiver.Address, 10, fee)
+		if err := mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	pending, err := mempool.Transactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 ||
+		!bytes.Equal(pending[0].ID, txs[1].ID) ||
+		!bytes.Equal(pending[1].ID, txs[2].ID) ||
+		!bytes.Equal(pending[2].ID, txs[0].ID) {
+		t.Fatal("pending transactions are not ordered by fee")
+	}
+
+	maxBlockTransactions := MaxBlockTransactions
+	MaxBlockTransactions = 2
+	defer func() { MaxBlockTransactions = maxBlockTransactions }()
+
+	block, err := chain.MinePending(context.Background(), owner.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(block.Transactions) != 3 ||
+		!bytes.Equal(block.Transactions[1].ID, txs[1].ID) ||
+		!bytes.Equal(block.Transactions[2].ID, txs[2].ID) {
+		t.Fatal("the block does not have the two transactions with the highest fees")
+	}
+	if got, want := block.Transactions[0].Outputs[0].Value, Subsidy(block.Height)+8; got != want {
+		t.Errorf("coinbase value %d, want %d", got, want)
+	}
+
+	pending, err = mempool.Transactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || !bytes.Equal(pending[0].ID, txs[0].ID) {
+		t.Fatal("only the transaction with the lowest fee should stay in the mempool")
+	}
+}
+
+// um bloco recebido remove do mempool as transações que ele inclui
+// e as que gastam os mesmos outputs
+func TestMempoolEvictionAfterBlock(t *testing.T) {
+	owner, miner, receiver := newTestKey(t), newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	mempool := Mempool{BlockChain: chain}
+	mineTestOutputs(t, chain, owner, 1)
+
+	// sem transações pendentes as duas gastam o mesmo output do owner
+	spend := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	doubleSpend := newTestTx(t, chain, owner, miner.Address, 10, 1)
+	if !bytes.Equal(spend.Inputs[0].ID, doubleSpend.Inputs[0].ID) || spend.Inputs[0].Out != doubleSpend.Inputs[0].Out {
+		t.Fatal("the transactions should spend the same output")
+	}
+
+	if err := mempool.Add(spend); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	if err := mempool.Add(other); err != nil {
+		t.Fatal(err)
+	}
+
+	// o bloco de outro minerador inclui a transação conflitante
+	block := mineTestBlock(t, chain, lastBlock(t, chain), miner.Address, doubleSpend)
+	if err := chain.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mempool.FindTransaction(spend.ID); !errors.Is(err, ErrTxNotFound) {
+		t.Fatalf("the conflicting transaction is still in the mempool: %v", err)
+	}
+	if _, err := mempool.FindTransaction(other.ID); err != nil {
+		t.Fatalf("the unrelated transaction was removed: %v", err)
+	}
+
+	block = mineTestBlock(t, chain, lastBlock(t, chain), miner.Address, other)
+	if err := chain.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := mempool.Count(); err != nil || count != 0 {
+		t.Fatalf("mempool has %d transactions, %v, want none", count, err)
+	}
+}
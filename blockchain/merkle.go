@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTxNotInTree = errors.New("transaction is not in the merkle tree")
+)
+
+// MerkleTree guarda todos os niveis da arvore,
+// do nivel das folhas (0) até a raiz
+type MerkleTree struct {
+	Levels [][][]byte
+
+	// versão do bloco, que define como os hashes são calculados
+	Version int
+}
+
+// MerkleProofStep é um irmão no caminho entre a folha e a raiz.
+// Left indica que o irmão fica a esquerda do hash calculado
+type MerkleProofStep struct {
+	Hash []byte
+	Left bool
+}
+
+// MerkleProof prova que uma transação faz parte de um bloco
+// sem a necessidade de conhecer as demais transações
+type MerkleProof struct {
+	TxID  []byte
+	Index int
+	Steps []MerkleProofStep
+}
+
+// a partir da versão 2 as folhas e os nós internos recebem prefixos diferentes,
+// assim um nó interno de 64 bytes não pode ser apresentado como uma folha
+const (
+	merkleLeafPrefix  = 0x00
+	merkleInnerPrefix = 0x01
+)
+
+func merkleHash(version int, prefix byte, data ...[]byte) []byte {
+	hasher := sha256.New()
+	if version > legacyBlockVersion {
+		hasher.Write([]byte{prefix})
+	}
+	for _, datum := range data {
+		hasher.Write(datum)
+	}
+	return hasher.Sum(nil)
+}
+
+func merkleLeaf(version int, data []byte) []byte {
+	return merkleHash(version, merkleLeafPrefix, data)
+}
+
+func merkleParent(version int, left, right []byte) []byte {
+	return merkleHash(version, merkleInnerPrefix, left, right)
+}
+
+func NewMerkleTree(data [][]byte, version int) *MerkleTree {
+	var leaves [][]byte
+
+	for _, datum := range data {
+		leaves = append(leaves, merkleLeaf(version, datum))
+	}
+
+	if len(leaves) == 0 {
+		leaves = append(leaves, merkleLeaf(version, []byte{}))
+	}
+
+	tree := &MerkleTree{Levels: [][][]byte{leaves}, Version: version}
+
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+
+		// quando o nivel tem um numero impar de nós o ultimo é combinado com
+		// ele mesmo, por isso os blocos não podem repetir transações
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, merkleParent(version, level[i], right))
+		}
+
+		tree.Levels = append(tree.Levels, next)
+		level = next
+	}
+
+	return tree
+}
+
+func (t *MerkleTree) Root() []byte {
+	return t.Levels[len(t.Levels)-1][0]
+}
+
+// retorna a prova de inclusão da folha na posição index
+func (t *MerkleTree) Proof(index int) (MerkleProof, error) {
+	if index < 0 || index >= len(t.Levels[0]) {
+		return MerkleProof{}, ErrTxNotInTree
+	}
+
+	proof := MerkleProof{Index: index}
+
+	for _, level := range t.Levels[:len(t.Levels)-1] {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+
+		proof.Steps = append(proof.Steps, MerkleProofStep{
+			Hash: level[sibling],
+			Left: sibling < index,
+		})
+
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// recalcula a raiz a partir do ID da transação e dos irmãos e a compara com
+// a do header, o lado de cada irmão deve corresponder a posição da folha
+func (p MerkleProof) Verify(header BlockHeader) bool {
+	if len(p.TxID) != sha256.Size || len(p.Steps) >= strconv.IntSize-1 {
+		return false
+	}
+	if p.Index < 0 || p.Index >= 1<<uint(len(p.Steps)) {
+		return false
+	}
+
+	hash := merkleLeaf(header.Version, p.TxID)
+
+	for level, step := range p.Steps {
+		if len(step.Hash) != sha256.Size || step.Left != (p.Index>>uint(level)&1 == 1) {
+			return false
+		}
+
+		if step.Left {
+			hash = merkleParent(header.Version, step.Hash, hash)
+		} else {
+			hash = merkleParent(header.Version, hash, step.Hash)
+		}
+	}
+
+	return bytes.Equal(hash, header.MerkleRoot)
+}
+
+func (p MerkleProof) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("-- Merkle Proof %x:", p.TxID))
+	lines = append(lines, fmt.Sprintf("    Index:     %d", p.Index))
+	for index, step := range p.Steps {
+		side := "right"
+		if step.Left {
+			side = "left"
+		}
+		lines = append(lines, fmt.Sprintf("    Step %d:    %x (%s)", index, step.Hash, side))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// IDs das transações usadas nos testes, sha256("tx0"), sha256("tx1")...
+func testTxIDs(count int) [][]byte {
+	var IDs [][]byte
+	for i := 0; i < count; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("tx%d", i)))
+		IDs = append(IDs, hash[:])
+	}
+	return IDs
+}
+
+func TestMerkleRoot(t *testing.T) {
+	tests := []struct {
+		leaves  int
+		version int
+		root    string
+	}{
+		{0, 1, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{1, 1, "ba7b78fe1b215636d326b297f0a60df4f20b9e3cbaa0bc0e76a093b4d88d087c"},
+		{2, 1, "8a2f3bd2712833a933e80114515bd2e731b5c1447fd96888a3bb4b1f51d044cd"},
+		{3, 1, "48bea3961d526f4c4e7aa5f6d2de1e502ec5816c17c179bb99e7a9d1e36da78c"},
+		{5, 1, "cb27432f6c6ecb6a55e91bed410184964cd2ee7d99d981e6a9afa5f512051437"},
+
+		// na versão 2 as folhas começam com 0x00 e os nós internos com 0x01
+		{0, 2, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"},
+		{1, 2, "5e0bee3b0a2e783a0e43a5b93c5d769ad07969cb6213d009763153f07134fca3"},
+		{2, 2, "cd8e9a192f1c2b8e3a7e36dbef6ef90cac12fed7f2d18e4daf169a304f6b2438"},
+		{3, 2, "a281a60da8404a650db4568832a660cd6f1922d3342f46cb1398d7ebde443e73"},
+		{5, 2, "848e2da56decdc338fb2b531d53ad63db6d337fc299c5b1671f4649dbe09fb0b"},
+	}
+
+	for _, test := range tests {
+		root := hex.EncodeToString(NewMerkleTree(testTxIDs(test.leaves), test.version).Root())
+		if root != test.root {
+			t.Errorf("%d leaves, version %d: root %s, want %s", test.leaves, test.version, root, test.root)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, version := range []int{legacyBlockVersion, BlockVersion} {
+		for _, count := range []int{1, 2, 3, 4, 5, 7} {
+			IDs := testTxIDs(count)
+			tree := NewMerkleTree(IDs, version)
+			header := BlockHeader{Version: version, MerkleRoot: tree.Root()}
+
+			for index, ID := range IDs {
+				proof, err := tree.Proof(index)
+				if err != nil {
+					t.Fatal(err)
+				}
+				proof.TxID = ID
+
+				if !proof.Verify(header) {
+					t.Errorf("version %d, %d leaves: proof of leaf %d failed", version, count, index)
+				}
+
+				other := proof
+				other.TxID = IDs[(index+1)%count]
+				if count > 1 && other.Verify(header) {
+					t.Errorf("version %d, %d leaves: proof of leaf %d accepted another ID", version, count, index)
+				}
+			}
+
+			if _, err := tree.Proof(count); !errors.Is(err, ErrTxNotInTree) {
+				t.Errorf("proof past the last leaf returned %v, want %v", err, ErrTxNotInTree)
+			}
+		}
+	}
+}
+
+// a posição da folha define o lado de cada irmão, assim a mesma
+// prova não pode ser apresentada para outra posição
+func TestMerkleProofPosition(t *testing.T) {
+	IDs := testTxIDs(5)
+	tree := NewMerkleTree(IDs, BlockVersion)
+	header := BlockHeader{Version: BlockVersion, MerkleRoot: tree.Root()}
+
+	proof, err := tree.Proof(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof.TxID = IDs[4]
+	if !proof.Verify(header) {
+		t.Fatal("proof of the last leaf failed")
+	}
+
+	// o ultimo nó de um nivel impar é combinado com ele mesmo, como irmão a direita
+	if len(proof.Steps) != 3 || proof.Steps[0].Left || proof.Steps[1].Left || !proof.Steps[2].Left {
+		t.Fatalf("unexpected steps %v", proof.Steps)
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *MerkleProof)
+	}{
+		{"negative index", func(p *MerkleProof) { p.Index = -1 }},
+		{"index past the steps", func(p *MerkleProof) { p.Index += 1 << uint(len(p.Steps)) }},
+		{"index of the duplicated leaf", func(p *MerkleProof) { p.Index = 5 }},
+		{"flipped side", func(p *MerkleProof) { p.Steps[0].Left = !p.Steps[0].Left }},
+		{"short ID", func(p *MerkleProof) { p.TxID = p.TxID[:31] }},
+		{"short sibling", func(p *MerkleProof) { p.Steps[1].Hash = p.Steps[1].Hash[:31] }},
+		{"missing step", func(p *MerkleProof) { p.Steps = p.Steps[:2] }},
+	}
+
+	for _, test := range tests {
+		changed := proof
+		changed.TxID = append([]byte{}, proof.TxID...)
+		changed.Steps = append([]MerkleProofStep{}, proof.Steps...)
+		test.change(&changed)
+
+		if changed.Verify(header) {
+			t.Errorf("%s: proof accepted", test.name)
+		}
+	}
+
+	// a prova de uma versão não vale para a outra
+	legacy := header
+	legacy.Version = legacyBlockVersion
+	if proof.Verify(legacy) {
+		t.Error("version 2 proof accepted by a version 1 header")
+	}
+}
+
+func TestBlockMerkleProof(t *testing.T) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	tx := newTestTx(t, chain, owner, receiver.Address, 10, 1)
+	block := mineTestBlock(t, chain, lastBlock(t, chain), owner.Address, tx)
+
+	for _, blockTx := range block.Transactions {
+		proof, err := block.MerkleProof(blockTx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Verify(block.BlockHeader) {
+			t.Errorf("proof of %x failed", blockTx.ID)
+		}
+	}
+
+	if _, err := block.MerkleProof(testTxIDs(1)[0]); !errors.Is(err, ErrTxNotInTree) {
+		t.Fatalf("proof of a missing transaction returned %v, want %v", err, ErrTxNotInTree)
+	}
+}
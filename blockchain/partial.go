@@ -0,0 +1,478 @@
+package blockchain
+
+import (
+	"blockchain-tutorial/script"
+	"blockchain-tutorial/wallet"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// limita o indice dos outputs gastos, que define o tamanho
+	// das transações anteriores montadas por prevTXs
+	maxPrevOutputIndex = 1 << 16
+)
+
+var (
+	ErrInvalidPartialTx = errors.New("invalid partial transaction")
+	ErrNotSigned        = errors.New("transaction is not fully signed")
+	ErrKeyMismatch      = errors.New("key does not own the spent outputs")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrInvalidFee       = errors.New("invalid fee")
+)
+
+// PartialTransaction é uma transação que ainda precisa ser assinada, junto
+// com os outputs que os seus inputs gastam, assim ela pode ser assinada
+// em outra maquina, somente com a carteira e sem acesso a blockchain
+type PartialTransaction struct {
+	Transaction Transaction
+
+	// output gasto por cada input, na mesma ordem dos inputs
+	PrevOutputs []TxOutput
+
+	// script multisig dos outputs gastos e as assinaturas de cada input, na
+	// ordem das chaves do script, que viram o script de desbloqueio ao chegar a M
+	RedeemScript      []byte
+	PartialSignatures [][][]byte
+}
+
+func (ptx *PartialTransaction) Serialize() ([]byte, error) {
+	var buff bytes.Buffer
+	encoder := gob.NewEncoder(&buff)
+
+	if err := encoder.Encode(ptx); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+func DeserializePartialTransaction(data []byte) (*PartialTransaction, error) {
+	var ptx PartialTransaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+
+	if err := decoder.Decode(&ptx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPartialTx, err)
+	}
+
+	if err := ptx.check(); err != nil {
+		return nil, err
+	}
+
+	return &ptx, nil
+}
+
+// o valor enviado deve ser positivo, a taxa não pode ser negativa
+// e a soma dos dois não pode passar de MaxMoney
+func CheckAmount(amount, fee int) error {
+	if amount <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidAmount, amount)
+	}
+	if fee < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidFee, fee)
+	}
+	if amount > MaxMoney()-fee {
+		return fmt.Errorf("%w: %d + %d", ErrValueOutOfRange, amount, fee)
+	}
+	return nil
+}
+
+// cria a transação que paga amount ao receiver com os outputs do sender,
+// sem assinar, portanto sem precisar da chave privada do sender
+func NewPartialTransaction(sender, receiver string, amount, fee int, chain *BlockChain) (*PartialTransaction, error) {
+	if err := CheckAmount(amount, fee); err != nil {
+		return nil, err
+	}
+
+	var inputs []TxInput
+	var outputs []TxOutput
+	var prevOutputs []TxOutput
+
+	pubKeyHash, err := wallet.PublicKeyHashFromAddress(sender)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := UTXOSet{chain}
+	accumulated, validOutputs, err := UTXOSet.FindSpendableOutputs(pubKeyHash, amount+fee)
+	if err != nil {
+		return nil, err
+	}
+
+	if accumulated < amount+fee {
+		return nil, fmt.Errorf("%w: %d available, %d needed", ErrInsufficientFunds, accumulated, amount+fee)
+	}
+
+	for txID, outs := range validOutputs {
+		txIDAsBytes, err := hex.DecodeString(txID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, out := range outs {
+			prevOutput, unspent, err := UTXOSet.FindOutput(txIDAsBytes, out)
+			if err != nil {
+				return nil, err
+			}
+			if !unspent {
+				return nil, fmt.Errorf("%w: %s", ErrMissingOutput, outpoint(txIDAsBytes, out))
+			}
+
+			inputs = append(inputs, TxInput{ID: txIDAsBytes, Out: out})
+			prevOutputs = append(prevOutputs, prevOutput)
+		}
+	}
+
+	output, err := NewTxOutput(amount, receiver)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
+
+	if accumulated > amount+fee {
+		payBack, err := NewTxOutput(accumulated-amount-fee, sender)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *payBack)
+	}
+
+	tx := Transaction{
+		Inputs:  inputs,
+		Outputs: outputs,
+		Version: TxVersion,
+	}
+	tx.SetID()
+
+	return &PartialTransaction{Transaction: tx, PrevOutputs: prevOutputs}, nil
+}
+
+// trava a transação até a altura ou o timestamp lockTime e cada input até que
+// o output gasto tenha a idade pedida em sequence, deve ser chamado antes de assinar
+func (ptx *PartialTransaction) SetLocks(lockTime, sequence uint32) error {
+	if signed, _ := ptx.Signatures(); signed > 0 {
+		return fmt.Errorf("%w: locks must be set before signing", ErrInvalidPartialTx)
+	}
+	if err := checkSequence(sequence); err != nil {
+		return err
+	}
+
+	ptx.Transaction.LockTime = lockTime
+	for index := range ptx.Transaction.Inputs {
+		ptx.Transaction.Inputs[index].Sequence = sequence
+	}
+
+	ptx.Transaction.ID = nil
+	ptx.Transaction.SetID()
+	return nil
+}
+
+// cada input precisa do output que gasta e os outputs não podem somar mais que os inputs
+func (ptx *PartialTransaction) check() error {
+	if len(ptx.Transaction.Inputs) == 0 || ptx.Transaction.IsCoinbase() {
+		return fmt.Errorf("%w: no inputs to sign", ErrInvalidPartialTx)
+	}
+	if ptx.Transaction.Version < TxVersion {
+		return fmt.Errorf("%w: %v %d", ErrInvalidPartialTx, ErrTxVersion, ptx.Transaction.Version)
+	}
+	if len(ptx.PrevOutputs) != len(ptx.Transaction.Inputs) {
+		return fmt.Errorf("%w: %d inputs but %d spent outputs", ErrInvalidPartialTx, len(ptx.Transaction.Inputs), len(ptx.PrevOutputs))
+	}
+	for _, in := range ptx.Transaction.Inputs {
+		if in.Out < 0 || in.Out > maxPrevOutputIndex {
+			return fmt.Errorf("%w: invalid output index %d", ErrInvalidPartialTx, in.Out)
+		}
+		if err := checkSequence(in.Sequence); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPartialTx, err)
+		}
+	}
+	fee, err := ptx.Fee()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPartialTx, err)
+	}
+	if fee < 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidPartialTx, ErrInsufficientInputs)
+	}
+	if len(ptx.PartialSignatures) != 0 && len(ptx.PartialSignatures) != len(ptx.Transaction.Inputs) {
+		return fmt.Errorf("%w: %d inputs but signatures for %d", ErrInvalidPartialTx, len(ptx.Transaction.Inputs), len(ptx.PartialSignatures))
+	}
+	return nil
+}
+
+// a diferença entre os outputs gastos e os criados
+func (ptx *PartialTransaction) Fee() (int, error) {
+	inputs := 0
+	for _, out := range ptx.PrevOutputs {
+		var err error
+		if inputs, err = addValue(inputs, out.Value); err != nil {
+			return 0, err
+		}
+	}
+
+	outputs, err := ptx.Transaction.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+
+	return inputs - outputs, nil
+}
+
+// hash da chave publica ou do script dono dos outputs gastos, que deve ser o mesmo em todos
+func (ptx *PartialTransaction) PublicKeyHash() ([]byte, error) {
+	if err := ptx.check(); err != nil {
+		return nil, err
+	}
+
+	lockingScript := ptx.PrevOutputs[0].LockingScript()
+	for _, out := range ptx.PrevOutputs[1:] {
+		if !bytes.Equal(out.LockingScript(), lockingScript) {
+			return nil, fmt.Errorf("%w: inputs spend outputs of different addresses", ErrInvalidPartialTx)
+		}
+	}
+
+	pubKeyHash := ptx.PrevOutputs[0].AddressHash()
+	if pubKeyHash == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNonStandard, script.Disassemble(lockingScript))
+	}
+	return pubKeyHash, nil
+}
+
+// monta as transações anteriores somente com os outputs gastos,
+// o que basta para Transaction.Sign e Transaction.Verify
+func (ptx *PartialTransaction) prevTXs() map[string]Transaction {
+	prevTXs := make(map[string]Transaction)
+
+	for index, in := range ptx.Transaction.Inputs {
+		id := hex.EncodeToString(in.ID)
+		prevTX, ok := prevTXs[id]
+		if !ok {
+			prevTX = Transaction{ID: in.ID}
+		}
+		for len(prevTX.Outputs) <= in.Out {
+			prevTX.Outputs = append(prevTX.Outputs, TxOutput{})
+		}
+		prevTX.Outputs[in.Out] = ptx.PrevOutputs[index]
+		prevTXs[id] = prevTX
+	}
+
+	return prevTXs
+}
+
+// verdadeiro quando os outputs gastos pertencem a um endereço multisig
+func (ptx *PartialTransaction) IsMultisig() bool {
+	if len(ptx.PrevOutputs) == 0 {
+		return false
+	}
+	class, _ := script.Extract(ptx.PrevOutputs[0].LockingScript())
+	return class == script.ScriptHash
+}
+
+// adiciona o script dos outputs multisig gastos, que os
+// participantes precisam para saber quais chaves assinam
+func (ptx *PartialTransaction) SetMultisigScript(multisig *wallet.MultisigScript) error {
+	pubKeyHash, err := ptx.PublicKeyHash()
+	if err != nil {
+		return err
+	}
+	if !ptx.IsMultisig() || !bytes.Equal(multisig.Hash(), pubKeyHash) {
+		return fmt.Errorf("%w: script does not match the spent outputs", ErrInvalidPartialTx)
+	}
+
+	ptx.RedeemScript = multisig.Serialize()
+	ptx.PartialSignatures = make([][][]byte, len(ptx.Transaction.Inputs))
+	for index := range ptx.PartialSignatures {
+		ptx.PartialSignatures[index] = make([][]byte, len(multisig.PublicKeys))
+	}
+	return nil
+}
+
+// retorna o script multisig da transação, verificado contra os outputs gastos
+func (ptx *PartialTransaction) MultisigScript() (*wallet.MultisigScript, error) {
+	pubKeyHash, err := ptx.PublicKeyHash()
+	if err != nil {
+		return nil, err
+	}
+	if !ptx.IsMultisig() {
+		return nil, fmt.Errorf("%w: inputs are not multisig", ErrInvalidPartialTx)
+	}
+	if len(ptx.RedeemScript) == 0 {
+		return nil, fmt.Errorf("%w: missing multisig script", ErrInvalidPartialTx)
+	}
+
+	multisig, err := wallet.ParseMultisigScript(ptx.RedeemScript)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(multisig.Hash(), pubKeyHash) {
+		return nil, fmt.Errorf("%w: script does not match the spent outputs", ErrInvalidPartialTx)
+	}
+	for _, signatures := range ptx.PartialSignatures {
+		if len(signatures) != len(multisig.PublicKeys) {
+			return nil, fmt.Errorf("%w: %d signatures for %d keys", ErrInvalidPartialTx, len(signatures), len(multisig.PublicKeys))
+		}
+	}
+	return multisig, nil
+}
+
+// quantidade de assinaturas presentes e necessarias, contando
+// o input com menos assinaturas
+func (ptx *PartialTransaction) Signatures() (int, int) {
+	required := 1
+	if multisig, err := ptx.MultisigScript(); err == nil {
+		required = multisig.M
+	}
+
+	signed := -1
+	for index, in := range ptx.Transaction.Inputs {
+		count := 0
+		if index < len(ptx.PartialSignatures) {
+			for _, signature := range ptx.PartialSignatures[index] {
+				if len(signature) > 0 {
+					count++
+				}
+			}
+		} else if len(in.UnlockingScript()) > 0 {
+			count++
+		}
+		if signed < 0 || count < signed {
+			signed = count
+		}
+	}
+	if signed < 0 {
+		signed = 0
+	}
+
+	return signed, required
+}
+
+// assina todos os inputs com a chave dona dos outputs gastos,
+// ou com uma das chaves do script nos inputs multisig
+func (ptx *PartialTransaction) Sign(privateKey wallet.PrivateKey) error {
+	pubKeyHash, err := ptx.PublicKeyHash()
+	if err != nil {
+		return err
+	}
+
+	if ptx.IsMultisig() {
+		return ptx.signMultisig(privateKey)
+	}
+
+	if !bytes.Equal(wallet.PublicKeyHash(privateKey.PublicKey()), pubKeyHash) {
+		return ErrKeyMismatch
+	}
+
+	if err := ptx.Transaction.Sign(privateKey, ptx.prevTXs()); err != nil {
+		return err
+	}
+
+	return ptx.Verify()
+}
+
+// guarda a assinatura na posição da chave e, quando todos os inputs
+// possuem M assinaturas, monta os scripts de desbloqueio
+func (ptx *PartialTransaction) signMultisig(privateKey wallet.PrivateKey) error {
+	multisig, err := ptx.MultisigScript()
+	if err != nil {
+		return err
+	}
+
+	keyIndex := multisig.KeyIndex(privateKey.PublicKey())
+	if keyIndex < 0 {
+		return ErrKeyMismatch
+	}
+
+	for index := range ptx.Transaction.Inputs {
+		hash, err := ptx.Transaction.SignatureHash(index, ptx.PrevOutputs[index])
+		if err != nil {
+			return err
+		}
+
+		signature, err := privateKey.Sign(hash)
+		if err != nil {
+			return err
+		}
+		ptx.PartialSignatures[index][keyIndex] = signature
+	}
+
+	if signed, required := ptx.Signatures(); signed < required {
+		return nil
+	}
+
+	for index, signatures := range ptx.PartialSignatures {
+		var selected [][]byte
+		for _, signature := range signatures {
+			if len(signature) > 0 && len(selected) < multisig.M {
+				selected = append(selected, signature)
+			}
+		}
+		ptx.Transaction.Inputs[index].Script = script.ScriptHashSignatureScript(selected, ptx.RedeemScript)
+	}
+
+	return ptx.Verify()
+}
+
+func (ptx *PartialTransaction) IsSigned() bool {
+	for _, in := range ptx.Transaction.Inputs {
+		if len(in.UnlockingScript()) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// verifica os scripts contra os outputs gastos informados no arquivo,
+// a blockchain confirma esses outputs quando a transação é enviada
+func (ptx *PartialTransaction) Verify() error {
+	if err := ptx.check(); err != nil {
+		return err
+	}
+	if !ptx.IsSigned() {
+		return ErrNotSigned
+	}
+	if err := ptx.Transaction.VerifyScripts(ptx.prevTXs()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+func (ptx PartialTransaction) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("-- Partial Transaction %x:", ptx.Transaction.ID))
+	if ptx.Transaction.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("    LockTime: %s", formatLockTime(ptx.Transaction.LockTime)))
+	}
+	for index, in := range ptx.Transaction.Inputs {
+		lines = append(lines, fmt.Sprintf("    Input %d:", index))
+		lines = append(lines, fmt.Sprintf("      Spends:    %s", outpoint(in.ID, in.Out)))
+		if index < len(ptx.PrevOutputs) {
+			out := ptx.PrevOutputs[index]
+			lines = append(lines, fmt.Sprintf("      Address:   %s", out.Address()))
+			lines = append(lines, fmt.Sprintf("      Value:     %d", out.Value))
+		}
+		if in.Sequence != 0 {
+			lines = append(lines, fmt.Sprintf("      Sequence:  %#x", in.Sequence))
+		}
+	}
+
+	for index, out := range ptx.Transaction.Outputs {
+		lines = append(lines, fmt.Sprintf("    Output %d:", index))
+		lines = append(lines, fmt.Sprintf("      Address:   %s", out.Address()))
+		lines = append(lines, fmt.Sprintf("      Value:     %d", out.Value))
+	}
+
+	signed, required := ptx.Signatures()
+	if fee, err := ptx.Fee(); err == nil {
+		lines = append(lines, fmt.Sprintf("    Fee: %d", fee))
+	} else {
+		lines = append(lines, fmt.Sprintf("    Fee: %v", err))
+	}
+	lines = append(lines, fmt.Sprintf("    Signatures: %d of %d", signed, required))
+
+	return strings.Join(lines, "\n")
+}
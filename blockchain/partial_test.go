@@ -0,0 +1,172 @@
+package blockchain
+
+import (
+	"blockchain-tutorial/script"
+	"blockchain-tutorial/wallet"
+	"errors"
+	"testing"
+)
+
+// valores inválidos são rejeitados antes de procurar os outputs do sender
+func TestNewPartialTransactionAmount(t *testing.T) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	tests := []struct {
+		amount, fee int
+		err         error
+	}{
+		{0, 1, ErrInvalidAmount},
+		{-10, 1, ErrInvalidAmount},
+		{10, -1, ErrInvalidFee},
+		{MaxMoney(), 1, ErrValueOutOfRange},
+		{1, MaxMoney(), ErrValueOutOfRange},
+		{Subsidy(0) + 1, 0, ErrInsufficientFunds},
+		{10, 1, nil},
+	}
+
+	for _, test := range tests {
+		_, err := NewPartialTransaction(owner.Address, receiver.Address, test.amount, test.fee, chain)
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+			t.Errorf("amount %d fee %d returned %v, want %v", test.amount, test.fee, err, test.err)
+		}
+	}
+}
+
+// paga value a um endereço 2 de 3 e retorna a transação parcial que gasta esse
+// output, ainda sem assinaturas, junto com as chaves na ordem do script
+func newMultisigPartialTx(t *testing.T) (*BlockChain, func(), *PartialTransaction, []testKey) {
+	owner, receiver := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+
+	unsorted := []testKey{newTestKey(t), newTestKey(t), newTestKey(t)}
+	var publicKeys [][]byte
+	for _, key := range unsorted {
+		publicKeys = append(publicKeys, key.PrivateKey.PublicKey())
+	}
+	multisig, err := wallet.NewMultisigScript(2, publicKeys)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	keys := make([]testKey, len(unsorted))
+	for _, key := range unsorted {
+		keys[multisig.KeyIndex(key.PrivateKey.PublicKey())] = key
+	}
+
+	fund := newTestTx(t, chain, owner, multisig.Address(), 50, 1)
+	if err := chain.AcceptBlock(mineTestBlock(t, chain, lastBlock(t, chain), owner.Address, fund)); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	ptx, err := NewPartialTransaction(multisig.Address(), receiver.Address, 40, 1, chain)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if !ptx.IsMultisig() {
+		cleanup()
+		t.Fatal("the partial transaction should spend a multisig output")
+	}
+	if err := ptx.SetMultisigScript(multisig); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	return chain, cleanup, ptx, keys
+}
+
+func TestMultisigSigning(t *testing.T) {
+	chain, cleanup, ptx, keys := newMultisigPartialTx(t)
+	defer cleanup()
+
+	mempool := Mempool{BlockChain: chain}
+
+	// com menos de M assinaturas o script de desbloqueio não é montado
+	if err := ptx.Sign(keys[2].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.Sign(keys[2].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if signed, required := ptx.Signatures(); signed != 1 || required != 2 {
+		t.Fatalf("%d of %d signatures, want 1 of 2", signed, required)
+	}
+	if err := ptx.Verify(); !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("verify with one signature returned %v, want %v", err, ErrNotSigned)
+	}
+	if err := mempool.Add(&ptx.Transaction); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("mempool accepted a transaction with one signature: %v", err)
+	}
+
+	if err := ptx.Sign(newTestKey(t).PrivateKey); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("signing with a key outside the script returned %v, want %v", err, ErrKeyMismatch)
+	}
+
+	// as assinaturas ficam na posição da chave, qualquer que seja a ordem em que são feitas
+	if err := ptx.Sign(keys[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if signed, required := ptx.Signatures(); signed != 2 || required != 2 || !ptx.IsSigned() {
+		t.Fatalf("%d of %d signatures, want 2 of 2", signed, required)
+	}
+	if err := mempool.Add(&ptx.Transaction); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// o script de desbloqueio precisa de M assinaturas diferentes na ordem das chaves
+func TestMultisigUnlockingScript(t *testing.T) {
+	_, cleanup, ptx, keys := newMultisigPartialTx(t)
+	defer cleanup()
+
+	for _, key := range keys {
+		if err := ptx.Sign(key.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ptx.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	signatures := ptx.PartialSignatures[0]
+	tests := []struct {
+		name       string
+		signatures [][]byte
+		valid      bool
+	}{
+		{"keys 0 and 1", [][]byte{signatures[0], signatures[1]}, true},
+		{"keys 0 and 2", [][]byte{signatures[0], signatures[2]}, true},
+		{"keys 1 and 2", [][]byte{signatures[1], signatures[2]}, true},
+		{"wrong order", [][]byte{signatures[1], signatures[0]}, false},
+		{"duplicated signature", [][]byte{signatures[0], signatures[0]}, false},
+		{"fewer than M", [][]byte{signatures[0]}, false},
+		{"no signatures", nil, false},
+	}
+
+	for _, test := range tests {
+		changed := *ptx
+		changed.Transaction.Inputs = append([]TxInput{}, ptx.Transaction.Inputs...)
+		changed.Transaction.Inputs[0].Script = script.ScriptHashSignatureScript(test.signatures, ptx.RedeemScript)
+
+		err := changed.Verify()
+		if test.valid && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidSignature)
+		}
+	}
+
+	// o script de outro endereço multisig não é aceito
+	other, err := wallet.NewMultisigScript(1, [][]byte{keys[0].PrivateKey.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.SetMultisigScript(other); !errors.Is(err, ErrInvalidPartialTx) {
+		t.Fatalf("setting another multisig script returned %v, want %v", err, ErrInvalidPartialTx)
+	}
+}
@@ -1,65 +1,152 @@
 package blockchain
 
 import (
-	"blockchain-tutorial/utils"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
-	"fmt"
+	"errors"
 	"math"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-const Difficulty = 14
-
 type ProofOfWork struct {
 	Block  *Block
 	Target *big.Int
 }
 
 func NewProofOfWork(block *Block) *ProofOfWork {
-	target := big.NewInt(1)
-
-	target.Lsh(target, uint(256-Difficulty))
+	target := CompactToBig(block.Bits)
 
 	pow := &ProofOfWork{block, target}
 	return pow
 }
 
 func (pow *ProofOfWork) InitData(nonce int) []byte {
-	return bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			Int64ToHex(int64(nonce)),
-			Int64ToHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
+	header := pow.Block.BlockHeader
+	header.Nonce = nonce
+	return header.Bytes()
 }
 
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var intHash big.Int
-	var hash [32]byte
+var (
+	ErrNonceExhausted = errors.New("no valid nonce found for the block")
+)
 
-	nonce := 0
+// MiningOptions configura a mineração de um bloco
+type MiningOptions struct {
+	// quantidade de goroutines procurando o nonce
+	Workers int
 
-	for nonce < math.MaxInt64 {
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
+	// chamado periodicamente com a quantidade de hashes por segundo
+	OnHashrate func(hashrate float64)
 
-		intHash.SetBytes(hash[:])
-		fmt.Printf("\rMining: %x", hash[:])
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nonce++
-		}
+	// intervalo entre cada chamada de OnHashrate
+	ReportInterval time.Duration
+}
+
+var DefaultMiningOptions = MiningOptions{
+	Workers:        runtime.NumCPU(),
+	ReportInterval: time.Second,
+}
+
+// procura um nonce valido dividindo o espaço de nonces entre os workers:
+// o worker i testa os nonces i, i+workers, i+2*workers, ...
+// a mineração é interrompida quando o ctx é cancelado
+func (pow *ProofOfWork) Run(ctx context.Context, opts MiningOptions) (int, []byte, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
 	}
 
-	fmt.Println()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	return nonce, hash[:]
+	type result struct {
+		nonce int
+		hash  []byte
+	}
+
+	found := make(chan result, workers)
+	var hashes uint64
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+
+		go func(nonce int) {
+			defer wg.Done()
+
+			var intHash big.Int
+			var count uint64
+
+			for ; nonce >= 0 && nonce < math.MaxInt64; nonce += workers {
+				hash := sha256.Sum256(pow.InitData(nonce))
+				intHash.SetBytes(hash[:])
+				count++
+
+				if intHash.Cmp(pow.Target) == -1 {
+					found <- result{nonce, hash[:]}
+					return
+				}
+
+				if count%1024 == 0 {
+					atomic.AddUint64(&hashes, count)
+					count = 0
+
+					select {
+					case <-ctx.Done():
+						return
+					default:
+					}
+				}
+			}
+		}(worker)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var ticker <-chan time.Time
+	if opts.OnHashrate != nil && opts.ReportInterval > 0 {
+		t := time.NewTicker(opts.ReportInterval)
+		defer t.Stop()
+		ticker = t.C
+	}
+
+	start := time.Now()
+
+	for {
+		select {
+		case res := <-found:
+			cancel()
+			<-done
+			return res.nonce, res.hash, nil
+
+		case <-done:
+			select {
+			case res := <-found:
+				return res.nonce, res.hash, nil
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return 0, nil, err
+			}
+			return 0, nil, ErrNonceExhausted
+
+		case <-ticker:
+			elapsed := time.Since(start).Seconds()
+			if elapsed > 0 {
+				opts.OnHashrate(float64(atomic.LoadUint64(&hashes)) / elapsed)
+			}
+		}
+	}
 }
 
 func (pow *ProofOfWork) Validate() bool {
@@ -68,14 +155,62 @@ func (pow *ProofOfWork) Validate() bool {
 	hash := sha256.Sum256(data)
 	intHash.SetBytes(hash[:])
 
-	return intHash.Cmp(pow.Target) == -1
+	if BigToCompact(pow.Target) != pow.Block.Bits {
+		return false
+	}
+
+	return intHash.Cmp(pow.Target) == -1 && bytes.Equal(hash[:], pow.Block.Hash)
 }
 
-func Int64ToHex(n int64) []byte {
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, n)
+// converte a dificuldade (quantidade de bits zero a esquerda)
+// para o formato compacto usado no campo Bits do header
+func DifficultyToBits(difficulty int) uint32 {
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-difficulty))
+	return BigToCompact(target)
+}
+
+// descompacta o Bits: os 3 ultimos bytes são a mantissa
+// e o primeiro byte é a quantidade de bytes do Target
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	exponent := uint(compact >> 24)
+
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		return big.NewInt(int64(mantissa))
+	}
+
+	target := big.NewInt(int64(mantissa))
+	return target.Lsh(target, 8*(exponent-3))
+}
 
-	utils.HandleError(err)
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
 
-	return buff.Bytes()
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, 8*(exponent-3)).Uint64())
+	}
+
+	// o bit mais alto da mantissa indica sinal,
+	// então o valor é deslocado para o proximo byte
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	return uint32(exponent<<24) | mantissa
+}
+
+func Int64ToHex(n int64) []byte {
+	buff := make([]byte, 8)
+	binary.BigEndian.PutUint64(buff, uint64(n))
+	return buff
 }
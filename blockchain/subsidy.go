@@ -0,0 +1,75 @@
+package blockchain
+
+var (
+	// recompensa paga ao minerador do bloco genesis
+	InitialSubsidy = 100
+
+	// quantidade de blocos até a recompensa ser dividida pela metade
+	HalvingInterval = 210
+)
+
+// nenhum output, nem a soma dos outputs de uma transação, pode passar
+// da quantidade de moedas que serão emitidas. É calculado a cada chamada
+// para acompanhar InitialSubsidy e HalvingInterval
+func MaxMoney() int {
+	return MaxSupply()
+}
+
+// retorna a recompensa do bloco na altura informada,
+// a cada HalvingInterval blocos a recompensa cai pela metade até chegar a zero
+func Subsidy(height int) int {
+	if HalvingInterval <= 0 {
+		return InitialSubsidy
+	}
+
+	halvings := height / HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return InitialSubsidy >> uint(halvings)
+}
+
+// retorna a quantidade maxima de moedas que serão emitidas,
+// sem halving a emissão não tem limite
+func MaxSupply() int {
+	if HalvingInterval <= 0 {
+		return int(^uint(0) >> 1)
+	}
+
+	supply := 0
+
+	for halvings := uint(0); halvings < 63; halvings++ {
+		subsidy := InitialSubsidy >> halvings
+		if subsidy == 0 {
+			break
+		}
+		supply += subsidy * HalvingInterval
+	}
+
+	return supply
+}
+
+// retorna a quantidade de moedas emitidas até a altura informada
+func ScheduledSupply(height int) int {
+	if HalvingInterval <= 0 {
+		return InitialSubsidy * (height + 1)
+	}
+
+	supply := 0
+
+	for start := 0; start <= height; start += HalvingInterval {
+		subsidy := Subsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		blocks := HalvingInterval
+		if start+blocks > height+1 {
+			blocks = height + 1 - start
+		}
+		supply += subsidy * blocks
+	}
+
+	return supply
+}
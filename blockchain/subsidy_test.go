@@ -0,0 +1,35 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// os limites acompanham os parametros da emissão, inclusive sem halving
+func TestSupplyFollowsParams(t *testing.T) {
+	initialSubsidy, halvingInterval := InitialSubsidy, HalvingInterval
+	defer func() { InitialSubsidy, HalvingInterval = initialSubsidy, halvingInterval }()
+
+	InitialSubsidy, HalvingInterval = 100, 210
+	if got, want := MaxMoney(), 41370; got != want {
+		t.Errorf("MaxMoney = %d, want %d", got, want)
+	}
+	if got, want := ScheduledSupply(209), 21000; got != want {
+		t.Errorf("ScheduledSupply(209) = %d, want %d", got, want)
+	}
+	if got, want := ScheduledSupply(210), 21050; got != want {
+		t.Errorf("ScheduledSupply(210) = %d, want %d", got, want)
+	}
+
+	InitialSubsidy, HalvingInterval = 50, 10
+	if got, want := MaxMoney(), 970; got != want {
+		t.Errorf("MaxMoney = %d, want %d", got, want)
+	}
+
+	HalvingInterval = 0
+	if got, want := ScheduledSupply(9), 500; got != want {
+		t.Errorf("ScheduledSupply(9) = %d, want %d", got, want)
+	}
+	if _, err := addValue(ScheduledSupply(1000), Subsidy(1001)); err != nil {
+		t.Errorf("value rejected without halving: %v", err)
+	}
+}
@@ -1,90 +1,150 @@
 package blockchain
 
 import (
-	"blockchain-tutorial/utils"
+	"blockchain-tutorial/script"
 	"blockchain-tutorial/wallet"
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
 )
 
-const (
-	coinbase = 100
-)
+// versão das novas transações, a partir dela a assinatura inclui o valor do output gasto
+const TxVersion = 1
 
 type Transaction struct {
 	ID      []byte
 	Inputs  []TxInput
 	Outputs []TxOutput
+	// altura ou timestamp a partir do qual a transação pode ser minerada, veja LockTimeThreshold
+	LockTime uint32
+	// zero nas transações anteriores a TxVersion
+	Version int
 }
 
-func (tx Transaction) Serialize() []byte {
+func (tx Transaction) Serialize() ([]byte, error) {
 	var encoded bytes.Buffer
 	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	utils.HandleError(err)
-	return encoded.Bytes()
+	if err := enc.Encode(tx); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
 }
 
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
-
-	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(tx)
-	utils.HandleError(err)
-
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+	tx.ID = tx.Hash()
 }
 
+// hash da transação sem os scripts de desbloqueio, que são adicionados
+// depois do ID ao assinar. Os blocos da versão 2 exigem que o ID seja este hash
 func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
-	txCopy := *tx
-	txCopy.ID = []byte{}
-	hash = sha256.Sum256(txCopy.Serialize())
+	var buff bytes.Buffer
+
+	writeInt(&buff, int64(tx.Version))
+	writeInt(&buff, int64(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		writeBytes(&buff, input.ID)
+		writeInt(&buff, int64(input.Out))
+		writeBytes(&buff, input.PublicKey)
+		writeInt(&buff, int64(input.Sequence))
+	}
+	writeInt(&buff, int64(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		writeInt(&buff, int64(output.Value))
+		writeBytes(&buff, output.PublicKeyHash)
+		writeBytes(&buff, output.Script)
+	}
+	writeInt(&buff, int64(tx.LockTime))
+
+	hash := sha256.Sum256(buff.Bytes())
 	return hash[:]
 }
 
+// retorna a soma dos valores dos outputs, cada output deve ser positivo
+// e nem ele nem a soma podem passar de MaxMoney. Os outputs OP_RETURN
+// devem ter valor zero, qualquer valor neles seria destruido
+func (tx *Transaction) OutputValue() (int, error) {
+	total := 0
+	for _, out := range tx.Outputs {
+		if out.IsUnspendable() {
+			if out.Value != 0 {
+				return 0, ErrInvalidOutput
+			}
+			continue
+		}
+
+		if out.Value <= 0 {
+			return 0, ErrInvalidOutput
+		}
+
+		var err error
+		if total, err = addValue(total, out.Value); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
 func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
-func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+// assina os inputs que gastam outputs PayToPubKeyHash, os
+// outputs multisig são assinados por PartialTransaction
+func (tx *Transaction) Sign(privateKey wallet.PrivateKey, prevTXs map[string]Transaction) error {
 	if tx.IsCoinbase() {
-		return
+		return nil
+	}
+
+	if tx.Version < TxVersion {
+		return fmt.Errorf("%w: version %d does not sign the spent values", ErrTxVersion, tx.Version)
 	}
 
 	for _, input := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(input.ID)].ID == nil {
-			utils.HandleError(errors.New("ERROR: Previous transaction is not correct"))
+		if _, err := prevOutput(prevTXs, input); err != nil {
+			return err
 		}
 	}
 
-	txCopy := tx.TrimmedCopy()
+	publicKey := privateKey.PublicKey()
+
+	for index, input := range tx.Inputs {
+		prevOut, _ := prevOutput(prevTXs, input)
+
+		if class, _ := script.Extract(prevOut.LockingScript()); class != script.PubKeyHash {
+			return fmt.Errorf("%w: input %d spends a %s output", ErrNonStandard, index, class)
+		}
+
+		hash, err := tx.SignatureHash(index, prevOut)
+		if err != nil {
+			return err
+		}
+
+		signature, err := privateKey.Sign(hash)
+		if err != nil {
+			return err
+		}
 
-	for index, input := range txCopy.Inputs {
-		prevTX := prevTXs[hex.EncodeToString(input.ID)]
-		txCopy.Inputs[index].Signature = nil
-		txCopy.Inputs[index].PublicKey = prevTX.Outputs[input.Out].PublicKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[index].PublicKey = nil
+		tx.Inputs[index].Script = script.SignatureScript(signature, publicKey)
+	}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.ID)
-		utils.HandleError(err)
+	return nil
+}
 
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Inputs[index].Signature = signature
+// output gasto pelo input, entre as transações anteriores
+func prevOutput(prevTXs map[string]Transaction, input TxInput) (TxOutput, error) {
+	prevTX := prevTXs[hex.EncodeToString(input.ID)]
+	if prevTX.ID == nil {
+		return TxOutput{}, fmt.Errorf("%w: previous transaction %x", ErrTxNotFound, input.ID)
 	}
+	if input.Out < 0 || input.Out >= len(prevTX.Outputs) {
+		return TxOutput{}, fmt.Errorf("%w: %x:%d", ErrMissingOutput, input.ID, input.Out)
+	}
+	return prevTX.Outputs[input.Out], nil
 }
 
 func (tx *Transaction) TrimmedCopy() Transaction {
@@ -96,87 +156,274 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 			Out:       input.Out,
 			Signature: nil,
 			PublicKey: nil,
+			Sequence:  input.Sequence,
 		})
 	}
 	for _, output := range tx.Outputs {
 		outputs = append(outputs, TxOutput{
 			Value:         output.Value,
 			PublicKeyHash: output.PublicKeyHash,
+			Script:        output.Script,
 		})
 	}
 
 	return Transaction{
-		ID:      tx.ID,
-		Inputs:  inputs,
-		Outputs: outputs,
+		ID:       tx.ID,
+		Inputs:   inputs,
+		Outputs:  outputs,
+		LockTime: tx.LockTime,
+		Version:  tx.Version,
 	}
 }
 
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
-	if tx.IsCoinbase() {
-		return true
+// hash assinado pelo input index, a transação sem os scripts de desbloqueio
+// e com o script do output gasto no lugar do script do input
+func (tx *Transaction) SignatureHash(index int, prevOut TxOutput) ([]byte, error) {
+	if tx.isLegacy() {
+		return tx.legacySignatureHash(index, prevOut)
 	}
 
+	txCopy := tx.TrimmedCopy()
+	txCopy.Inputs[index].Script = prevOut.LockingScript()
+
+	// a partir da TxVersion o hash inclui a versão e o valor do output gasto,
+	// como no BIP143, assim quem assina offline não pode ser enganado sobre
+	// o valor dos inputs e a taxa. Antes dela as travas só entram no hash
+	// quando existem, assim as transações assinadas antes delas continuam validas
+	versioned := txCopy.Version >= TxVersion
+	locks := versioned || txCopy.hasLocks()
+
+	var buff bytes.Buffer
+	if versioned {
+		writeInt(&buff, int64(txCopy.Version))
+	}
+	writeInt(&buff, int64(len(txCopy.Inputs)))
+	for i, input := range txCopy.Inputs {
+		writeBytes(&buff, input.ID)
+		writeInt(&buff, int64(input.Out))
+		writeBytes(&buff, input.Script)
+		if locks {
+			writeInt(&buff, int64(input.Sequence))
+		}
+		if versioned && i == index {
+			writeInt(&buff, int64(prevOut.Value))
+		}
+	}
+	writeInt(&buff, int64(len(txCopy.Outputs)))
+	for _, output := range txCopy.Outputs {
+		writeInt(&buff, int64(output.Value))
+		writeBytes(&buff, output.LockingScript())
+	}
+	if locks {
+		writeInt(&buff, int64(txCopy.LockTime))
+	}
+
+	hash := sha256.Sum256(buff.Bytes())
+	return hash[:], nil
+}
+
+func writeInt(buff *bytes.Buffer, n int64) {
+	var encoded [8]byte
+	binary.LittleEndian.PutUint64(encoded[:], uint64(n))
+	buff.Write(encoded[:])
+}
+
+func writeBytes(buff *bytes.Buffer, data []byte) {
+	writeInt(buff, int64(len(data)))
+	buff.Write(data)
+}
+
+// transações com locktime ou com sequence em algum input
+func (tx *Transaction) hasLocks() bool {
+	if tx.LockTime != 0 {
+		return true
+	}
 	for _, input := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(input.ID)].ID == nil {
-			utils.HandleError(errors.New("ERROR: Previous transaction is not correct"))
+		if input.Sequence != 0 {
+			return true
 		}
 	}
+	return false
+}
 
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+// transações anteriores aos scripts, nenhum output possui script e
+// não há versão nem travas de tempo, que o formato antigo não assina
+func (tx *Transaction) isLegacy() bool {
+	if tx.Version >= TxVersion || tx.hasLocks() {
+		return false
+	}
+	for _, output := range tx.Outputs {
+		if len(output.Script) > 0 {
+			return false
+		}
+	}
+	return true
+}
 
-	for index, input := range tx.Inputs {
+// hash assinado pelas transações anteriores aos scripts, a transação serializada
+// com gob com o hash da chave do output gasto no input. O gob inclui os nomes
+// e os campos dos tipos, por isso os tipos da epoca são declarados aqui
+func (tx *Transaction) legacySignatureHash(index int, prevOut TxOutput) ([]byte, error) {
+	type TxInput struct {
+		ID        []byte
+		Out       int
+		Signature []byte
+		PublicKey []byte
+	}
+	type TxOutput struct {
+		Value         int
+		PublicKeyHash []byte
+	}
+	type Transaction struct {
+		ID      []byte
+		Inputs  []TxInput
+		Outputs []TxOutput
+	}
 
-		prevTX := prevTXs[hex.EncodeToString(input.ID)]
-		txCopy.Inputs[index].Signature = nil
-		txCopy.Inputs[index].PublicKey = prevTX.Outputs[input.Out].PublicKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[index].PublicKey = nil
+	var txCopy Transaction
+	for i, input := range tx.Inputs {
+		txCopy.Inputs = append(txCopy.Inputs, TxInput{ID: input.ID, Out: input.Out})
+		if i == index {
+			txCopy.Inputs[i].PublicKey = prevOut.PublicKeyHash
+		}
+	}
+	for _, output := range tx.Outputs {
+		txCopy.Outputs = append(txCopy.Outputs, TxOutput{Value: output.Value, PublicKeyHash: output.PublicKeyHash})
+	}
 
-		var r, s big.Int
-		sigLen := len(input.Signature)
-		r.SetBytes(input.Signature[:(sigLen / 2)])
-		s.SetBytes(input.Signature[(sigLen / 2):])
+	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(txCopy); err != nil {
+		return nil, err
+	}
 
-		var x, y big.Int
-		keyLen := len(input.PublicKey)
-		x.SetBytes(input.PublicKey[:(keyLen) / 2])
-		y.SetBytes(input.PublicKey[(keyLen/2):])
+	hash := sha256.Sum256(encoded.Bytes())
+	return hash[:], nil
+}
 
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
-			return false
+// txChecker liga os opcodes de assinatura e de locktime ao input validado
+type txChecker struct {
+	tx      *Transaction
+	index   int
+	prevOut TxOutput
+}
+
+func (c txChecker) CheckSignature(signature, publicKey []byte) bool {
+	hash, err := c.tx.SignatureHash(c.index, c.prevOut)
+	if err != nil {
+		return false
+	}
+	return wallet.VerifySignature(publicKey, hash, signature)
+}
+
+// o locktime do script e o da transação devem ser do mesmo tipo, altura ou
+// timestamp, e o da transação não pode ser menor, a validação do bloco garante
+// que ele ja foi alcançado
+func (c txChecker) CheckLockTime(lockTime int64) bool {
+	if (lockTime < LockTimeThreshold) != (c.tx.LockTime < LockTimeThreshold) {
+		return false
+	}
+	return lockTime <= int64(c.tx.LockTime)
+}
+
+// o mesmo para a trava relativa do script e o sequence do input
+func (c txChecker) CheckSequence(sequence int64) bool {
+	if sequence&^(SequenceTypeFlag|SequenceLockMask) != 0 {
+		return false
+	}
+
+	inputSequence := int64(c.tx.Inputs[c.index].Sequence)
+	if sequence&SequenceTypeFlag != inputSequence&SequenceTypeFlag {
+		return false
+	}
+	return sequence&SequenceLockMask <= inputSequence&SequenceLockMask
+}
+
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+	return tx.VerifyScripts(prevTXs) == nil
+}
+
+// executa o script de desbloqueio de cada input seguido do script do output gasto
+func (tx *Transaction) VerifyScripts(prevTXs map[string]Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	var prevOuts []TxOutput
+	for _, input := range tx.Inputs {
+		prevOut, err := prevOutput(prevTXs, input)
+		if err != nil {
+			return err
 		}
+		prevOuts = append(prevOuts, prevOut)
 	}
 
-	return true
+	return tx.verifyScripts(prevOuts)
+}
+
+// o mesmo que VerifyScripts, com o output gasto por cada input na ordem dos inputs
+func (tx *Transaction) verifyScripts(prevOuts []TxOutput) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	if len(prevOuts) != len(tx.Inputs) {
+		return fmt.Errorf("%w: %d spent outputs for %d inputs", ErrMissingOutput, len(prevOuts), len(tx.Inputs))
+	}
+
+	for index, prevOut := range prevOuts {
+		checker := txChecker{tx: tx, index: index, prevOut: prevOut}
+		if err := script.Execute(tx.Inputs[index].UnlockingScript(), prevOut.LockingScript(), checker); err != nil {
+			return fmt.Errorf("input %d: %w", index, err)
+		}
+	}
+
+	return nil
 }
 
 func (tx Transaction) String() string {
 	var lines []string
 
 	lines = append(lines, fmt.Sprintf("-- Transaction %x:", tx.ID))
+	if tx.Version != 0 {
+		lines = append(lines, fmt.Sprintf("    Version:  %d", tx.Version))
+	}
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("    LockTime: %s", formatLockTime(tx.LockTime)))
+	}
 	for index, input := range tx.Inputs {
 		lines = append(lines, fmt.Sprintf("    Input %d:", index))
 		lines = append(lines, fmt.Sprintf("      TXID:      %x", input.ID))
 		lines = append(lines, fmt.Sprintf("      Out:       %d", input.Out))
-		lines = append(lines, fmt.Sprintf("      Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("      PublicKey: %x", input.PublicKey))
+		if tx.IsCoinbase() {
+			lines = append(lines, fmt.Sprintf("      Coinbase:  %x", input.PublicKey))
+		} else {
+			lines = append(lines, fmt.Sprintf("      Script:    %s", script.Disassemble(input.UnlockingScript())))
+		}
+		if input.Sequence != 0 {
+			lines = append(lines, fmt.Sprintf("      Sequence:  %#x", input.Sequence))
+		}
 	}
 
 	for index, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("    Output %d:", index))
 		lines = append(lines, fmt.Sprintf("      Value:     %d", output.Value))
-		lines = append(lines, fmt.Sprintf("      Script: %x", output.PublicKeyHash))
+		lines = append(lines, fmt.Sprintf("      Script:    %s", script.Disassemble(output.LockingScript())))
 	}
 
 	return strings.Join(lines, "\n")
 }
 
-func CoinbaseTx(to, data string) *Transaction {
+// cria a transação que paga a recompensa ao minerador,
+// value é a recompensa do bloco somada as taxas das transações
+func CoinbaseTx(to, data string, value int) (*Transaction, error) {
 	if data == "" {
-		data = fmt.Sprintf("Coins to %s", to)
+		// dados aleatorios evitam que duas coinbases
+		// para o mesmo endereço tenham o mesmo ID
+		randData := make([]byte, 24)
+		if _, err := rand.Read(randData); err != nil {
+			return nil, err
+		}
+		data = fmt.Sprintf("Coins to %s %x", to, randData)
 	}
 
 	txIn := TxInput{
@@ -185,56 +432,46 @@ func CoinbaseTx(to, data string) *Transaction {
 		Signature: nil,
 		PublicKey: []byte(data),
 	}
-	txOut := NewTxOutput(coinbase, to)
+	txOut, err := NewTxOutput(value, to)
+	if err != nil {
+		return nil, err
+	}
 
 	tx := &Transaction{
 		Inputs:  []TxInput{txIn},
 		Outputs: []TxOutput{*txOut},
+		Version: TxVersion,
 	}
 
 	tx.SetID()
 
-	return tx
+	return tx, nil
 }
 
-func NewTransaction(sender, receiver string, amount int, chain *BlockChain) *Transaction {
-	var inputs []TxInput
-	var outputs []TxOutput
-
+// a taxa é a diferença entre inputs e outputs e fica com o minerador do bloco,
+// lockTime e sequence travam a transação, zero quando ela pode ser minerada a qualquer momento
+func NewTransaction(sender, receiver string, amount, fee int, lockTime, sequence uint32, chain *BlockChain) (*Transaction, error) {
 	wallets, err := wallet.LoadWallets()
-	utils.HandleError(err)
-	w := wallets.GetWallet(sender)
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
-
-	accumulated, validOutputs := chain.FindSpendableOutputs(pubKeyHash, amount)
-
-	if accumulated < amount {
-		log.Panic("ERROR: not enough funds")
+	if err != nil {
+		return nil, err
 	}
-
-	for txID, outs := range validOutputs {
-		txIDAsBytes, err := hex.DecodeString(txID)
-		utils.HandleError(err)
-
-		for _, out := range outs {
-			input := TxInput{ID: txIDAsBytes, Out: out, PublicKey: w.PublicKey}
-			inputs = append(inputs, input)
-		}
+	w, err := wallets.GetWallet(sender)
+	if err != nil {
+		return nil, err
 	}
 
-	outputs = append(outputs, *NewTxOutput(amount, receiver))
+	ptx, err := NewPartialTransaction(sender, receiver, amount, fee, chain)
+	if err != nil {
+		return nil, err
+	}
 
-	if accumulated > amount {
-		payBack := accumulated - amount
-		outputs = append(outputs, *NewTxOutput(payBack, sender))
+	if err := ptx.SetLocks(lockTime, sequence); err != nil {
+		return nil, err
 	}
 
-	tx := Transaction{
-		Inputs:  inputs,
-		Outputs: outputs,
+	if err := ptx.Sign(w.PrivateKey); err != nil {
+		return nil, err
 	}
-	tx.SetID()
-	chain.SignTx(&tx, w.PrivateKey)
 
-	return &tx
+	return &ptx.Transaction, nil
 }
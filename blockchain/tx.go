@@ -1,39 +1,129 @@
 package blockchain
 
 import (
+	"blockchain-tutorial/script"
 	"blockchain-tutorial/wallet"
 	"bytes"
+	"encoding/gob"
+	"sort"
 )
 
 type TxOutput struct {
-	Value     int
+	Value int
+	// outputs anteriores aos scripts possuem somente o hash da chave publica
 	PublicKeyHash []byte
+	// script que trava o output
+	Script []byte
 }
 
-func NewTxOutput(value int, address string) *TxOutput {
-	txo := &TxOutput{value, nil}
-	txo.Lock([]byte(address))
-	return txo
+func NewTxOutput(value int, address string) (*TxOutput, error) {
+	txo := &TxOutput{Value: value}
+	if err := txo.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
+	return txo, nil
 }
 
-func (out *TxOutput) Lock(address []byte) {
-	pubKeyHash := wallet.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1:len(pubKeyHash) - 4]
-	out.PublicKeyHash = pubKeyHash
+func (out *TxOutput) Lock(address []byte) error {
+	pubKeyHash, multisig, err := wallet.DecodeAddress(string(address))
+	if err != nil {
+		return err
+	}
+	if multisig {
+		out.Script = script.PayToScriptHash(pubKeyHash)
+	} else {
+		out.Script = script.PayToPubKeyHash(pubKeyHash)
+	}
+	return nil
+}
+
+// script que trava o output, nos outputs antigos é o
+// PayToPubKeyHash do hash da chave publica
+func (out *TxOutput) LockingScript() []byte {
+	if len(out.Script) == 0 && len(out.PublicKeyHash) > 0 {
+		return script.PayToPubKeyHash(out.PublicKeyHash)
+	}
+	return out.Script
+}
+
+// outputs que começam com OP_RETURN guardam dados e nunca podem
+// ser gastos, por isso não entram no UTXO set
+func (out *TxOutput) IsUnspendable() bool {
+	locking := out.LockingScript()
+	return len(locking) > 0 && locking[0] == script.OP_RETURN
+}
+
+// hash da chave publica ou do script multisig que recebe o output,
+// nil quando o script não é PayToPubKeyHash nem PayToScriptHash
+func (out *TxOutput) AddressHash() []byte {
+	_, hash := script.Extract(out.LockingScript())
+	return hash
+}
+
+// endereço que recebe o output, de acordo com o tipo do script
+func (out *TxOutput) Address() string {
+	class, hash := script.Extract(out.LockingScript())
+	switch class {
+	case script.PubKeyHash:
+		return wallet.AddressFromPublicKeyHash(hash)
+	case script.ScriptHash:
+		return wallet.AddressFromScriptHash(hash)
+	}
+	return ""
 }
 
 func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PublicKeyHash, pubKeyHash) == 0
+	hash := out.AddressHash()
+	return hash != nil && bytes.Compare(hash, pubKeyHash) == 0
 }
 
 type TxInput struct {
 	ID  []byte
 	Out int
+	// inputs anteriores aos scripts possuem somente a assinatura e
+	// a chave publica, na coinbase PublicKey guarda dados arbitrarios
 	Signature []byte
 	PublicKey []byte
+	// script que desbloqueia o output gasto
+	Script []byte
+	// trava relativa do input, veja SequenceTypeFlag
+	Sequence uint32
+}
+
+// script que desbloqueia o output gasto, nos inputs antigos
+// é formado pela assinatura e pela chave publica
+func (in *TxInput) UnlockingScript() []byte {
+	if len(in.Script) == 0 && len(in.Signature) > 0 {
+		return script.SignatureScript(in.Signature, in.PublicKey)
+	}
+	return in.Script
+}
+
+type TxOutputs struct {
+	Outputs map[int]TxOutput
+}
+
+func (outs TxOutputs) Serialize() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(outs); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func DeserializeOutputs(data []byte) (TxOutputs, error) {
+	var outputs TxOutputs
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&outputs)
+	return outputs, err
 }
 
-func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := wallet.PublicKeyHash(in.PublicKey)
-	return bytes.Compare(lockingHash, pubKeyHash) == 0
+// retorna os indexes dos outputs em ordem crescente
+func (outs TxOutputs) Indexes() []int {
+	var indexes []int
+	for index := range outs.Outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
 }
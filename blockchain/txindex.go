@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var (
+	// ID da transação -> altura e hash do bloco da blockchain principal que a contém
+	txIndexPrefix = []byte("txindex-")
+	// indica que o indice de transações ja foi construido
+	txIndexKey = []byte("txindex")
+)
+
+// txLocation é o bloco da blockchain principal que contém uma transação
+type txLocation struct {
+	Height    int
+	BlockHash []byte
+}
+
+func txIndexKeyFor(txID []byte) []byte {
+	return prefixedKey(txIndexPrefix, txID)
+}
+
+// 8 bytes com a altura seguidos do hash do bloco
+func (l txLocation) encode() []byte {
+	encoded := make([]byte, 8, 8+len(l.BlockHash))
+	binary.BigEndian.PutUint64(encoded, uint64(l.Height))
+	return append(encoded, l.BlockHash...)
+}
+
+func decodeTxLocation(data []byte) (txLocation, error) {
+	if len(data) < 8 {
+		return txLocation{}, fmt.Errorf("invalid transaction index entry %x", data)
+	}
+	return txLocation{
+		Height:    int(binary.BigEndian.Uint64(data[:8])),
+		BlockHash: append([]byte{}, data[8:]...),
+	}, nil
+}
+
+// indexa as transações do bloco que entrou na blockchain principal
+func indexTransactions(txn *badger.Txn, block *Block) error {
+	location := txLocation{Height: block.Height, BlockHash: block.Hash}.encode()
+
+	for _, tx := range block.Transactions {
+		if err := txn.Set(txIndexKeyFor(tx.ID), location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove as transações do bloco que saiu da blockchain principal
+func unindexTransactions(txn *badger.Txn, block *Block) error {
+	for _, tx := range block.Transactions {
+		if err := txn.Delete(txIndexKeyFor(tx.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retorna o bloco da blockchain principal que contém a transação, ou ErrTxNotFound
+func (bc *BlockChain) transactionLocation(ID []byte) (txLocation, error) {
+	var location txLocation
+
+	err := bc.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(txIndexKeyFor(ID))
+		if err != nil {
+			return err
+		}
+
+		encoded, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		location, err = decodeTxLocation(encoded)
+		return err
+	})
+	if err == badger.ErrKeyNotFound || err == badger.ErrEmptyKey {
+		return txLocation{}, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
+	}
+
+	return location, err
+}
+
+// constrói o indice nas blockchains criadas antes dele
+func (bc *BlockChain) reindexTransactions() error {
+	if err := bc.db.DropPrefix(txIndexPrefix); err != nil {
+		return err
+	}
+
+	batch := bc.db.NewWriteBatch()
+	defer batch.Cancel()
+
+	it := bc.Iterator()
+	for len(bc.LastHash()) > 0 {
+		block, err := it.Next()
+		if err != nil {
+			return err
+		}
+
+		location := txLocation{Height: block.Height, BlockHash: block.Hash}.encode()
+		for _, tx := range block.Transactions {
+			if err := batch.Set(txIndexKeyFor(tx.ID), location); err != nil {
+				return err
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	if err := batch.Set(txIndexKey, []byte{1}); err != nil {
+		return err
+	}
+
+	return batch.Flush()
+}
+
+func (bc *BlockChain) hasTransactionIndex() (bool, error) {
+	err := bc.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(txIndexKey)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,280 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+var (
+	utxoPrefix = []byte("utxo-")
+)
+
+// UTXOSet mantém no badger um indice com os outputs ainda não gastos,
+// evitando percorrer toda a blockchain a cada consulta de saldo
+type UTXOSet struct {
+	BlockChain *BlockChain
+}
+
+func utxoKey(txID []byte) []byte {
+	return append(append([]byte{}, utxoPrefix...), txID...)
+}
+
+// reconstrói o indice a partir de todos os blocos da blockchain
+func (u UTXOSet) Reindex() error {
+	db := u.BlockChain.db
+
+	if err := db.DropPrefix(utxoPrefix); err != nil {
+		return err
+	}
+
+	UTXO, err := u.BlockChain.FindAllUTXO()
+	if err != nil {
+		return err
+	}
+
+	batch := db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for txID, outs := range UTXO {
+		key, err := hex.DecodeString(txID)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := outs.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if err := batch.Set(utxoKey(key), encoded); err != nil {
+			return err
+		}
+	}
+
+	return batch.Flush()
+}
+
+// atualiza o indice com as transações de um novo bloco
+func (u UTXOSet) Update(block *Block) error {
+	return u.BlockChain.db.Update(func(txn *badger.Txn) error {
+		return updateUTXO(txn, block)
+	})
+}
+
+// os outputs gastos pelo bloco são guardados para que ele possa ser desfeito
+func updateUTXO(txn *badger.Txn, block *Block) error {
+	undo := blockUndo{Spent: make(map[string]TxOutput)}
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Inputs {
+				key := utxoKey(in.ID)
+
+				item, err := txn.Get(key)
+				if err != nil {
+					return err
+				}
+
+				encoded, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				outs, err := DeserializeOutputs(encoded)
+				if err != nil {
+					return err
+				}
+				undo.Spent[outpoint(in.ID, in.Out)] = outs.Outputs[in.Out]
+				delete(outs.Outputs, in.Out)
+
+				if len(outs.Outputs) == 0 {
+					err = txn.Delete(key)
+				} else {
+					err = setOutputs(txn, in.ID, outs)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		outs := TxOutputs{Outputs: make(map[int]TxOutput)}
+		for index, out := range tx.Outputs {
+			if !out.IsUnspendable() {
+				outs.Outputs[index] = out
+			}
+		}
+		if len(outs.Outputs) == 0 {
+			continue
+		}
+
+		if err := setOutputs(txn, tx.ID, outs); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := undo.serialize()
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(prefixedKey(undoPrefix, block.Hash), encoded)
+}
+
+// grava os outputs não gastos da transação no indice
+func setOutputs(txn *badger.Txn, txID []byte, outs TxOutputs) error {
+	encoded, err := outs.Serialize()
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(utxoKey(txID), encoded)
+}
+
+// percorre todas as entradas do indice
+func (u UTXOSet) forEach(fn func(txID []byte, outs TxOutputs) bool) error {
+	return u.BlockChain.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
+			item := it.Item()
+			txID := bytes.TrimPrefix(item.KeyCopy(nil), utxoPrefix)
+
+			encoded, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			outs, err := DeserializeOutputs(encoded)
+			if err != nil {
+				return err
+			}
+
+			if !fn(txID, outs) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]TxOutput, error) {
+	var UTXOs []TxOutput
+
+	err := u.forEach(func(txID []byte, outs TxOutputs) bool {
+		for _, index := range outs.Indexes() {
+			out := outs.Outputs[index]
+			if out.IsLockedWithKey(pubKeyHash) {
+				UTXOs = append(UTXOs, out)
+			}
+		}
+		return true
+	})
+
+	return UTXOs, err
+}
+
+// retorna o saldo suficiente de uma carteira para ser usado em uma transação,
+// ignorando os outputs que ja estão sendo gastos por transações do mempool
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+
+	pending, err := Mempool{u.BlockChain}.SpentOutputs()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = u.forEach(func(txID []byte, outs TxOutputs) bool {
+		id := hex.EncodeToString(txID)
+
+		for _, index := range outs.Indexes() {
+			out := outs.Outputs[index]
+			if out.IsLockedWithKey(pubKeyHash) && !pending[outpoint(txID, index)] {
+				accumulated += out.Value
+				unspentOuts[id] = append(unspentOuts[id], index)
+
+				if accumulated >= amount {
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	return accumulated, unspentOuts, err
+}
+
+// retorna o output caso ele ainda não tenha sido gasto
+func (u UTXOSet) FindOutput(txID []byte, index int) (TxOutput, bool, error) {
+	var out TxOutput
+	var found bool
+
+	err := u.BlockChain.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(utxoKey(txID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		encoded, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		outs, err := DeserializeOutputs(encoded)
+		if err != nil {
+			return err
+		}
+
+		out, found = outs.Outputs[index]
+		return nil
+	})
+
+	return out, found, err
+}
+
+// indica se a transação ainda possui outputs não gastos
+func (u UTXOSet) HasOutputs(txID []byte) (bool, error) {
+	err := u.BlockChain.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(utxoKey(txID))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// retorna a soma de todos os outputs não gastos,
+// que é igual a quantidade de moedas em circulação
+func (u UTXOSet) TotalValue() (int, error) {
+	total := 0
+
+	err := u.forEach(func(txID []byte, outs TxOutputs) bool {
+		for _, out := range outs.Outputs {
+			total += out.Value
+		}
+		return true
+	})
+
+	return total, err
+}
+
+// retorna a quantidade de transações com outputs não gastos
+func (u UTXOSet) CountTransactions() (int, error) {
+	counter := 0
+
+	err := u.forEach(func(txID []byte, outs TxOutputs) bool {
+		counter++
+		return true
+	})
+
+	return counter, err
+}
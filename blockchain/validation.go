@@ -0,0 +1,348 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidSignature   = errors.New("invalid transaction signature")
+	ErrMissingOutput      = errors.New("input references a missing output")
+	ErrSpentOutput        = errors.New("input references an already spent output")
+	ErrInsufficientInputs = errors.New("transaction outputs exceed its inputs")
+	ErrInvalidOutput      = errors.New("transaction output has an invalid value")
+	ErrValueOutOfRange    = errors.New("transaction value out of range")
+	ErrBlockConflict      = errors.New("transaction conflicts with another transaction in the block")
+	ErrInvalidCoinbase    = errors.New("invalid coinbase transaction")
+	ErrNonStandard        = errors.New("output script is not standard")
+	ErrDuplicateTx        = errors.New("duplicate transaction")
+	ErrInvalidTxID        = errors.New("transaction ID does not match its hash")
+	ErrTxVersion          = errors.New("unsupported transaction version")
+)
+
+// TxError indica qual transação foi rejeitada e o motivo,
+// use errors.Is para comparar com os erros acima
+type TxError struct {
+	TxID []byte
+	Err  error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("transaction %x rejected: %v", e.TxID, e.Err)
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// retorna o output gasto por um input e a altura do bloco que o confirmou
+type outputFinder func(in TxInput) (TxOutput, int, error)
+
+// altura do bloco que recebe a transação e o tempo mediano dos blocos,
+// usados para verificar o locktime e o sequence dos inputs
+type lockContext struct {
+	height         int
+	medianTimePast medianTimeFunc
+}
+
+func outpoint(txID []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txID, index)
+}
+
+// valida os inputs, outputs e assinaturas de uma transação e retorna a diferença
+// entre inputs e outputs, as travas de tempo só são verificadas quando locks é informado
+func checkTransaction(tx *Transaction, find outputFinder, locks *lockContext) (int, error) {
+	var prevOuts []TxOutput
+	seen := make(map[string]bool)
+	inputs := 0
+
+	for _, in := range tx.Inputs {
+		if seen[outpoint(in.ID, in.Out)] {
+			return 0, ErrSpentOutput
+		}
+		seen[outpoint(in.ID, in.Out)] = true
+
+		if err := checkSequence(in.Sequence); err != nil {
+			return 0, err
+		}
+
+		out, prevHeight, err := find(in)
+		if err != nil {
+			return 0, err
+		}
+
+		if locks != nil {
+			if err := checkSequenceLock(in.Sequence, prevHeight, locks.height, locks.medianTimePast); err != nil {
+				return 0, err
+			}
+		}
+
+		if inputs, err = addValue(inputs, out.Value); err != nil {
+			return 0, err
+		}
+		prevOuts = append(prevOuts, out)
+	}
+
+	outputs, err := tx.OutputValue()
+	if err != nil {
+		return 0, err
+	}
+
+	if outputs > inputs {
+		return 0, ErrInsufficientInputs
+	}
+
+	if locks != nil {
+		if err := checkLockTime(tx, locks.height, locks.medianTimePast); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.verifyScripts(prevOuts); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	return inputs - outputs, nil
+}
+
+// a coinbase deve ser a primeira transação do bloco e não pode
+// pagar mais que a recompensa somada as taxas das transações
+func checkCoinbase(tx *Transaction, index, reward int) error {
+	if index != 0 {
+		return fmt.Errorf("%w: found at position %d", ErrInvalidCoinbase, index)
+	}
+
+	total, err := tx.OutputValue()
+	if err != nil {
+		return err
+	}
+
+	if total > reward {
+		return fmt.Errorf("%w: pays %d, more than the reward of %d", ErrInvalidCoinbase, total, reward)
+	}
+
+	return nil
+}
+
+// os valores são somados sem ultrapassar MaxMoney, assim a soma nunca
+// estoura o int e uma transação não consegue criar moedas
+func addValue(total, value int) (int, error) {
+	maxMoney := MaxMoney()
+	if value < 0 || value > maxMoney || total > maxMoney-value {
+		return 0, fmt.Errorf("%w: %d + %d", ErrValueOutOfRange, total, value)
+	}
+	return total + value, nil
+}
+
+// verificações do bloco que não dependem da blockchain, feitas antes de guarda-lo.
+// Um bloco que repete transações teria a mesma merkle root do bloco sem a
+// repetição, por isso elas são rejeitadas antes de calcular a raiz
+func checkBlock(block *Block) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("%w: %v: the first transaction must be the coinbase", ErrInvalidBlock, ErrInvalidCoinbase)
+	}
+
+	seen := make(map[string]bool)
+	for index, tx := range block.Transactions {
+		if index > 0 && tx.IsCoinbase() {
+			return fmt.Errorf("%w: %v: more than one coinbase", ErrInvalidBlock, ErrInvalidCoinbase)
+		}
+
+		if seen[string(tx.ID)] {
+			return fmt.Errorf("%w: %v %x", ErrInvalidBlock, ErrDuplicateTx, tx.ID)
+		}
+		seen[string(tx.ID)] = true
+
+		// os IDs das transações dos blocos antigos eram calculados com o gob
+		if block.Version > legacyBlockVersion && !bytes.Equal(tx.ID, tx.Hash()) {
+			return fmt.Errorf("%w: %v %x", ErrInvalidBlock, ErrInvalidTxID, tx.ID)
+		}
+
+		if block.Version > legacyBlockVersion && tx.Version < TxVersion {
+			return fmt.Errorf("%w: %v %d in %x", ErrInvalidBlock, ErrTxVersion, tx.Version, tx.ID)
+		}
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return fmt.Errorf("%w: merkle root does not match the transactions", ErrInvalidBlock)
+	}
+
+	return nil
+}
+
+// um bloco não pode ter uma versão menor que a do seu pai, assim as regras
+// de uma nova versão não podem ser evitadas depois de adotadas
+func checkBlockVersion(block, parent *Block) error {
+	if parent != nil && block.Version < parent.Version {
+		return fmt.Errorf("%w: version %d after version %d", ErrInvalidBlock, block.Version, parent.Version)
+	}
+	return nil
+}
+
+// o timestamp não pode passar de MaxFutureBlockTime a frente do relogio e, a partir
+// da versão 2, deve ser maior que o tempo mediano dos blocos anteriores, assim o
+// minerador não consegue atrasar os timestamps para baixar a dificuldade
+func checkBlockTime(block *Block, pastTime int64, now time.Time) error {
+	if block.Timestamp > now.Add(MaxFutureBlockTime).Unix() {
+		return fmt.Errorf("%w: timestamp %d is too far in the future", ErrInvalidBlock, block.Timestamp)
+	}
+
+	if block.Version > legacyBlockVersion && len(block.PrevHash) > 0 && block.Timestamp <= pastTime {
+		return fmt.Errorf("%w: timestamp %d is not after the median time %d", ErrInvalidBlock, block.Timestamp, pastTime)
+	}
+
+	return nil
+}
+
+// valida as transações de um novo bloco na altura informada contra o UTXO set,
+// rejeitando assinaturas invalidas, gastos duplos e conflitos dentro do bloco
+func (bc *BlockChain) ValidateTransactions(transactions []*Transaction, height int) error {
+	_, err := bc.validateTransactions(transactions, height, true)
+	return err
+}
+
+// retorna a soma das taxas das transações, checkLocks é falso somente no
+// mempool, que guarda as transações até que o locktime e o sequence permitam
+func (bc *BlockChain) validateTransactions(transactions []*Transaction, height int, checkLocks bool) (int, error) {
+	validator := bc.newTxValidator(height, checkLocks)
+
+	var coinbaseTx *Transaction
+	coinbaseIndex, fees := 0, 0
+
+	for index, tx := range transactions {
+		if tx.IsCoinbase() {
+			if coinbaseTx != nil {
+				return 0, &TxError{tx.ID, fmt.Errorf("%w: more than one coinbase", ErrInvalidCoinbase)}
+			}
+			if err := validator.create(tx); err != nil {
+				return 0, &TxError{tx.ID, err}
+			}
+			coinbaseTx, coinbaseIndex = tx, index
+			continue
+		}
+
+		fee, err := validator.add(tx)
+		if err == nil {
+			fees, err = addValue(fees, fee)
+		}
+		if err != nil {
+			return 0, &TxError{tx.ID, err}
+		}
+	}
+
+	if coinbaseTx != nil {
+		reward, err := addValue(fees, Subsidy(height))
+		if err == nil {
+			err = checkCoinbase(coinbaseTx, coinbaseIndex, reward)
+		}
+		if err != nil {
+			return 0, &TxError{coinbaseTx.ID, err}
+		}
+	}
+
+	return fees, nil
+}
+
+// txValidator valida transações em sequencia contra o UTXO set, como se fizessem
+// parte do mesmo bloco, guardando os outputs gastos e criados pelas anteriores
+type txValidator struct {
+	bc      *BlockChain
+	height  int
+	locks   *lockContext
+	spent   map[string]bool
+	created map[string]*Transaction
+}
+
+func (bc *BlockChain) newTxValidator(height int, checkLocks bool) *txValidator {
+	validator := &txValidator{
+		bc:      bc,
+		height:  height,
+		spent:   make(map[string]bool),
+		created: make(map[string]*Transaction),
+	}
+	if checkLocks {
+		validator.locks = &lockContext{height: height, medianTimePast: bc.MedianTimePast}
+	}
+	return validator
+}
+
+// valida a transação e, se ela for valida, a inclui no bloco, retornando a taxa
+func (v *txValidator) add(tx *Transaction) (int, error) {
+	fee, err := checkTransaction(tx, v.find, v.locks)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := v.create(tx); err != nil {
+		return 0, err
+	}
+	for _, in := range tx.Inputs {
+		v.spent[outpoint(in.ID, in.Out)] = true
+	}
+
+	return fee, nil
+}
+
+// guarda os outputs criados pela transação, um ID que ainda possui outputs
+// não gastos não pode ser reutilizado, ou eles seriam substituidos no UTXO set
+func (v *txValidator) create(tx *Transaction) error {
+	if _, exists := v.created[hex.EncodeToString(tx.ID)]; exists {
+		return ErrDuplicateTx
+	}
+
+	unspent, err := UTXOSet{v.bc}.HasOutputs(tx.ID)
+	if err != nil {
+		return err
+	}
+	if unspent {
+		return fmt.Errorf("%w: %x still has unspent outputs", ErrDuplicateTx, tx.ID)
+	}
+
+	v.created[hex.EncodeToString(tx.ID)] = tx
+	return nil
+}
+
+func (v *txValidator) find(in TxInput) (TxOutput, int, error) {
+	if v.spent[outpoint(in.ID, in.Out)] {
+		return TxOutput{}, 0, ErrBlockConflict
+	}
+
+	// outputs criados por transações anteriores do mesmo bloco
+	if prevTX, ok := v.created[hex.EncodeToString(in.ID)]; ok {
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) || prevTX.Outputs[in.Out].IsUnspendable() {
+			return TxOutput{}, 0, ErrMissingOutput
+		}
+		return prevTX.Outputs[in.Out], v.height, nil
+	}
+
+	out, unspent, err := UTXOSet{v.bc}.FindOutput(in.ID, in.Out)
+	if err != nil {
+		return TxOutput{}, 0, err
+	}
+
+	location, err := v.bc.transactionLocation(in.ID)
+	if errors.Is(err, ErrTxNotFound) {
+		return TxOutput{}, 0, ErrMissingOutput
+	}
+	if err != nil {
+		return TxOutput{}, 0, err
+	}
+
+	if !unspent {
+		// somente no caso de erro a transação é lida para diferenciar
+		// um output gasto de um output que não existe
+		prevTX, _, err := v.bc.findTransaction(in.ID)
+		if err != nil {
+			return TxOutput{}, 0, err
+		}
+		if in.Out < 0 || in.Out >= len(prevTX.Outputs) || prevTX.Outputs[in.Out].IsUnspendable() {
+			return TxOutput{}, 0, ErrMissingOutput
+		}
+		return TxOutput{}, 0, ErrSpentOutput
+	}
+
+	return out, location.Height, nil
+}
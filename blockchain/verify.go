@@ -0,0 +1,211 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VerifyFailure descreve um bloco ou transação invalida
+type VerifyFailure struct {
+	Height    int
+	BlockHash []byte
+	TxID      []byte
+	Reason    string
+}
+
+func (f VerifyFailure) String() string {
+	if f.TxID != nil {
+		return fmt.Sprintf("block %d (%x) tx %x: %s", f.Height, f.BlockHash, f.TxID, f.Reason)
+	}
+	return fmt.Sprintf("block %d (%x): %s", f.Height, f.BlockHash, f.Reason)
+}
+
+// VerifyReport é o resultado da verificação completa da blockchain
+type VerifyReport struct {
+	Blocks       int
+	Transactions int
+	Failures     []VerifyFailure
+}
+
+func (r VerifyReport) Valid() bool {
+	return len(r.Failures) == 0
+}
+
+func (r VerifyReport) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("Blocks:       %d", r.Blocks))
+	lines = append(lines, fmt.Sprintf("Transactions: %d", r.Transactions))
+
+	if r.Valid() {
+		lines = append(lines, "Result:       valid")
+	} else {
+		lines = append(lines, fmt.Sprintf("Result:       %d failure(s)", len(r.Failures)))
+		for _, failure := range r.Failures {
+			lines = append(lines, "  - "+failure.String())
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// percorre a blockchain do genesis até o ultimo bloco verificando
+// a prova de trabalho, a ligação entre os blocos e todas as transações
+func (bc *BlockChain) Verify() (VerifyReport, error) {
+	var report VerifyReport
+
+	hashes, err := bc.GetBlockHashes()
+	if err != nil {
+		return report, err
+	}
+
+	// outputs não gastos até o bloco atual
+	UTXO := make(map[string]TxOutputs)
+	var prevHash []byte
+	var prevBlock *Block
+
+	// altura em que cada transação foi confirmada e o timestamp de cada bloco
+	heights := make(map[string]int)
+	var timestamps []int64
+	now := time.Now()
+
+	medianTimePast := func(height int) (int64, error) {
+		if height >= len(timestamps) {
+			height = len(timestamps) - 1
+		}
+		if height < 0 {
+			height = 0
+		}
+		first := height - medianTimeBlocks + 1
+		if first < 0 {
+			first = 0
+		}
+		if first >= len(timestamps) {
+			return 0, nil
+		}
+		return medianTime(timestamps[first : height+1]), nil
+	}
+
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := bc.GetBlock(hashes[i])
+		if err != nil {
+			report.Failures = append(report.Failures, VerifyFailure{
+				Height:    len(hashes) - 1 - i,
+				BlockHash: hashes[i],
+				Reason:    err.Error(),
+			})
+			break
+		}
+
+		report.Blocks++
+
+		fail := func(txID []byte, format string, args ...interface{}) {
+			report.Failures = append(report.Failures, VerifyFailure{
+				Height:    block.Height,
+				BlockHash: block.Hash,
+				TxID:      txID,
+				Reason:    fmt.Sprintf(format, args...),
+			})
+		}
+
+		if block.Height != len(hashes)-1-i {
+			fail(nil, "height %d, expected %d", block.Height, len(hashes)-1-i)
+		}
+
+		if !bytes.Equal(block.PrevHash, prevHash) {
+			fail(nil, "previous hash %x does not link to %x", block.PrevHash, prevHash)
+		}
+
+		if pow, err := bc.ProofOfWork(block); err != nil {
+			fail(nil, "proof of work: %v", err)
+		} else if !pow.Validate() {
+			fail(nil, "invalid proof of work")
+		}
+
+		if err := checkBlock(block); err != nil {
+			fail(nil, "%v", err)
+		}
+
+		if err := checkBlockVersion(block, prevBlock); err != nil {
+			fail(nil, "%v", err)
+		}
+
+		if pastTime, err := medianTimePast(block.Height - 1); err != nil {
+			fail(nil, "%v", err)
+		} else if err := checkBlockTime(block, pastTime, now); err != nil {
+			fail(nil, "%v", err)
+		}
+
+		var coinbaseTx *Transaction
+		coinbaseIndex, fees := 0, 0
+
+		for index, tx := range block.Transactions {
+			report.Transactions++
+			txID := hex.EncodeToString(tx.ID)
+
+			if tx.IsCoinbase() {
+				if coinbaseTx != nil {
+					fail(tx.ID, "%v: more than one coinbase", ErrInvalidCoinbase)
+				}
+				coinbaseTx, coinbaseIndex = tx, index
+			} else {
+				fee, err := checkTransaction(tx, func(in TxInput) (TxOutput, int, error) {
+					outs, exists := UTXO[hex.EncodeToString(in.ID)]
+					if !exists {
+						return TxOutput{}, 0, ErrMissingOutput
+					}
+
+					out, unspent := outs.Outputs[in.Out]
+					if !unspent {
+						return TxOutput{}, 0, ErrSpentOutput
+					}
+
+					return out, heights[hex.EncodeToString(in.ID)], nil
+				}, &lockContext{height: block.Height, medianTimePast: medianTimePast})
+
+				if err == nil {
+					fees, err = addValue(fees, fee)
+				}
+				if err != nil {
+					fail(tx.ID, "%v", err)
+				} else {
+					for _, in := range tx.Inputs {
+						delete(UTXO[hex.EncodeToString(in.ID)].Outputs, in.Out)
+					}
+				}
+			}
+
+			if len(UTXO[txID].Outputs) > 0 {
+				fail(tx.ID, "%v: %x still has unspent outputs", ErrDuplicateTx, tx.ID)
+				continue
+			}
+
+			outs := TxOutputs{Outputs: make(map[int]TxOutput)}
+			for outIndex, out := range tx.Outputs {
+				if !out.IsUnspendable() {
+					outs.Outputs[outIndex] = out
+				}
+			}
+			UTXO[txID] = outs
+			heights[txID] = block.Height
+		}
+
+		if coinbaseTx != nil {
+			reward, err := addValue(fees, Subsidy(block.Height))
+			if err == nil {
+				err = checkCoinbase(coinbaseTx, coinbaseIndex, reward)
+			}
+			if err != nil {
+				fail(coinbaseTx.ID, "%v", err)
+			}
+		}
+
+		prevHash, prevBlock = block.Hash, block
+		timestamps = append(timestamps, block.Timestamp)
+	}
+
+	return report, nil
+}
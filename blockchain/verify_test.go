@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// um ID pode voltar a ser usado depois que todos os outputs dele foram gastos,
+// como aceito por AcceptBlock, então a verificação também deve aceita-lo
+func TestVerifyReusedSpentID(t *testing.T) {
+	owner, spender := newTestKey(t), newTestKey(t)
+	chain, cleanup := newTestChain(t, owner)
+	defer cleanup()
+
+	coinbase := func(height int) *Transaction {
+		tx, err := CoinbaseTx(spender.Address, "reused", Subsidy(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+
+	accept := func(block *Block) {
+		if err := chain.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := coinbase(1)
+	accept(mineTestBlockWith(t, chain, lastBlock(t, chain), []*Transaction{first}))
+
+	// gasta todo o valor da coinbase, sem troco
+	spend := newTestTx(t, chain, spender, owner.Address, Subsidy(1)-1, 1)
+	accept(mineTestBlock(t, chain, lastBlock(t, chain), owner.Address, spend))
+
+	reused := coinbase(3)
+	if string(reused.ID) != string(first.ID) {
+		t.Fatal("the coinbases should have the same ID")
+	}
+	accept(mineTestBlockWith(t, chain, lastBlock(t, chain), []*Transaction{reused}))
+
+	report, err := chain.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Fatalf("chain built by AcceptBlock failed verification:\n%s", report)
+	}
+	if report.Blocks != 4 || report.Transactions != 5 {
+		t.Fatalf("verified %d blocks and %d transactions, want 4 and 5", report.Blocks, report.Transactions)
+	}
+}
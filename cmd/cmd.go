@@ -2,18 +2,45 @@ package cmd
 
 import (
 	"blockchain-tutorial/blockchain"
+	"blockchain-tutorial/config"
+	"blockchain-tutorial/explorer"
+	"blockchain-tutorial/network"
+	"blockchain-tutorial/rpc"
 	"blockchain-tutorial/utils"
 	"blockchain-tutorial/wallet"
+	"bytes"
+	"context"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
-	"runtime"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// variaveis de ambiente com a senha do arquivo de carteiras,
+	// sem elas a senha é lida do terminal
+	passphraseEnv    = "WALLET_PASSPHRASE"
+	newPassphraseEnv = "WALLET_NEW_PASSPHRASE"
 )
 
+var errInvalidChain = errors.New("chain verification failed")
+
 type commandLine struct {
+	// argumentos após as opções globais, começando pelo comando
+	args   []string
+	config config.Config
+
+	// senha do arquivo de carteiras, lida uma unica vez
+	passphrase []byte
 }
 
 func NewCommandLine() *commandLine {
@@ -21,43 +48,125 @@ func NewCommandLine() *commandLine {
 }
 
 func (c *commandLine) usage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-datadir DIR] [-network mainnet|testnet|regtest] [-conf FILE] COMMAND")
 	fmt.Println(" init -address ADDRESS initialize a blockchain")
 	fmt.Println(" print - Prints the blocks in the chain")
-	fmt.Println(" send -from FROM -to TO -amount AMOUNT - Transfer coins")
-	fmt.Println(" getbalance -address ADDRESS - Get the balance for an address")
-	fmt.Println(" createwallet - Create a new Wallet")
-	fmt.Println(" listaddresses - List the addresses in our wallet file")
+	fmt.Println(" send -from FROM -to TO -amount AMOUNT [-fee FEE] [-locktime N] [-sequence N] - Queue a transfer in the mempool, mined only after the locks")
+	fmt.Println(" createrawtx -from FROM -to TO -amount AMOUNT [-fee FEE] [-locktime N] [-sequence N] -out FILE - Writes an unsigned transaction to FILE")
+	fmt.Println(" signrawtx -in FILE [-out FILE] - Signs the transaction with the wallet, without opening the chain")
+	fmt.Println(" broadcastrawtx -in FILE - Verifies a signed transaction and adds it to the mempool, also called submitrawtx")
+	fmt.Println(" mine -address MINER - Mine the pending transactions paying the reward to MINER")
+	fmt.Println(" getbalance -address ADDRESS | -label LABEL | -all - Get the balance for an address or for the wallet addresses")
+	fmt.Println(" createwallet [-mnemonic] - Create a new Wallet, -mnemonic starts an HD wallet with a new recovery phrase")
+	fmt.Println(" restorewallet -mnemonic \"WORDS\" [-gap N] - Restores the used addresses of an HD wallet")
+	fmt.Println(" listaddresses - List the addresses in our wallet file with their labels")
+	fmt.Println(" importaddress -address ADDRESS [-label LABEL] [-rescan=false] - Watches an address without its private key")
+	fmt.Println(" setlabel -address ADDRESS -label LABEL - Names an address of the wallet, an empty label removes it")
+	fmt.Println(" importprivkey -key KEY | -file FILE [-uncompressed] [-rescan=false] - Imports a hex, WIF or PEM private key")
+	fmt.Println(" getpubkey -address ADDRESS - Prints the public key of an address, to share with the other multisig signers")
+	fmt.Println(" addmultisig -m M -keys KEY,KEY,... [-label LABEL] - Adds an address that needs M signatures of the keys, given as public keys or wallet addresses")
+	fmt.Println(" dumpprivkey -address ADDRESS [-format wif|hex|pem] - Prints the private key of an address")
+	fmt.Println(" encryptwallet - Encrypts the wallet file with a passphrase")
+	fmt.Println(" changepassphrase - Changes the passphrase of the wallet file")
+	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
+	fmt.Println(" getproof -txid TXID - Prints the merkle proof of a transaction")
+	fmt.Println(" verifychain - Verifies every block and transaction in the chain")
+	fmt.Println(" supply - Prints the coins issued so far and the maximum supply")
+	fmt.Println(" getchaintips - Lists the tip of every known branch of the chain")
+	fmt.Println(" startnode -port PORT [-peers HOST:PORT,...] [-miner ADDRESS] - Starts a P2P node")
+	fmt.Println(" explorer -listen HOST:PORT - Starts the REST API and the block explorer")
+	fmt.Println(" rpcserver -listen HOST:PORT -user USER -password PASSWORD - Starts the JSON-RPC server")
 }
 
-func (c *commandLine) validate() {
-	if len(os.Args) < 2 {
+// lê as opções globais e o arquivo de configuração, aplicando
+// o datadir e a rede escolhida antes de executar o comando
+func (c *commandLine) configure() error {
+	globalCmd := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	globalCmd.Usage = c.usage
+
+	dataDir := globalCmd.String("datadir", config.DefaultDataDir, "The directory of the blockchain and wallet files")
+	networkName := globalCmd.String("network", "", "The network to use: mainnet, testnet or regtest")
+	configFile := globalCmd.String("conf", "", "The config file, defaults to DATADIR/"+config.FileName)
+
+	if err := globalCmd.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	c.args = globalCmd.Args()
+	if len(c.args) == 0 {
 		c.usage()
-		runtime.Goexit()
+		os.Exit(1)
+	}
+
+	c.config = config.Default()
+	c.config.DataDir = *dataDir
+
+	// o arquivo padrão é opcional, um arquivo informado com -conf não
+	path := *configFile
+	if path == "" {
+		path = c.config.File()
+	}
+	err := c.config.LoadFile(path)
+	if err != nil && !(os.IsNotExist(err) && *configFile == "") {
+		return err
+	}
+
+	if *networkName != "" {
+		c.config.Network = *networkName
 	}
+
+	wallet.Passphrase = c.walletPassphrase
+
+	return c.config.Apply()
+}
+
+// lê a senha do arquivo de carteiras na primeira vez em que ela é necessaria
+func (c *commandLine) walletPassphrase() ([]byte, error) {
+	if c.passphrase == nil {
+		passphrase, err := readPassphrase(passphraseEnv, "Wallet passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		c.passphrase = passphrase
+	}
+	return c.passphrase, nil
 }
 
-func (c *commandLine) init(address string) {
-	if !wallet.ValidateAddress(address) {
-		utils.HandleError(wallet.ErrInvalidAddress)
+func (c *commandLine) init(address string) error {
+	if err := wallet.ValidateAddress(address); err != nil {
+		return err
 	}
 
-	chain := blockchain.InitBlockChain(address)
-	chain.Close()
+	chain, err := blockchain.InitBlockChain(address)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
 	fmt.Println("BlockChain initialized!")
+	return nil
 }
 
-func (c *commandLine) print() {
+func (c *commandLine) print() error {
 
-	chain := blockchain.ContinueBlockChain("")
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
 	defer chain.Close()
 	it := chain.Iterator()
 
 	for {
 
-		block := it.Next()
+		block, err := it.Next()
+		if err != nil {
+			return err
+		}
 
-		pow := blockchain.NewProofOfWork(block)
+		pow, err := chain.ProofOfWork(block)
+		if err != nil {
+			return err
+		}
 
 		block.Info(strconv.FormatBool(pow.Validate()))
 
@@ -65,147 +174,1291 @@ func (c *commandLine) print() {
 			break
 		}
 	}
+
+	return nil
+}
+
+func (c *commandLine) getBalance(address string) error {
+	chain, err := blockchain.ContinueBlockChain(address)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	balance, _, err := addressBalance(chain, address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Balance of %s: %d\n", address, balance)
+	return nil
 }
 
-func (c *commandLine) getBalance(address string) {
-	if !wallet.ValidateAddress(address) {
-		utils.HandleError(wallet.ErrInvalidAddress)
+// mostra o saldo de cada endereço da carteira com o nome informado,
+// ou de todos os endereços quando o nome é vazio, e o total
+func (c *commandLine) getWalletBalance(label string) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	addresses := wallets.GetAllAddresses()
+	if label != "" {
+		addresses = wallets.GetAddressesByLabel(label)
+		if len(addresses) == 0 {
+			return fmt.Errorf("no addresses with label %q", label)
+		}
 	}
 
-	chain := blockchain.ContinueBlockChain(address)
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
 	defer chain.Close()
 
-	balance := 0
-	pubKeyHash := wallet.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1: len(pubKeyHash) - 4]
-	UTXOs := chain.FindUTXO(pubKeyHash)
+	total := 0
+	for _, address := range addresses {
+		balance, _, err := addressBalance(chain, address)
+		if err != nil {
+			return err
+		}
+		total += balance
 
+		fmt.Printf("%s: %d\n", addressInfo(wallets, address), balance)
+	}
+
+	fmt.Printf("Total: %d\n", total)
+	return nil
+}
+
+// soma os outputs não gastos do endereço, retornando o saldo e a quantidade de outputs
+func addressBalance(chain *blockchain.BlockChain, address string) (int, int, error) {
+	pubKeyHash, err := wallet.PublicKeyHashFromAddress(address)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	UTXOs, err := blockchain.UTXOSet{BlockChain: chain}.FindUTXO(pubKeyHash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	balance := 0
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	return balance, len(UTXOs), nil
+}
+
+// descreve o endereço com o seu nome e se ele é somente observado
+func addressInfo(wallets *wallet.WalletSet, address string) string {
+	info := address
+	if wallets.IsWatchOnly(address) {
+		info += " (watch-only)"
+	}
+	if script, err := wallets.GetMultisig(address); err == nil {
+		info += fmt.Sprintf(" (multisig %d-of-%d)", script.M, len(script.PublicKeys))
+	}
+	if label := wallets.Label(address); label != "" {
+		info += fmt.Sprintf(" %q", label)
+	}
+	return info
+}
+
+func (c *commandLine) send(sender, receiver string, amount, fee int, lockTime, sequence uint32) error {
+	if err := wallet.ValidateAddress(sender); err != nil {
+		return err
+	}
+	if err := wallet.ValidateAddress(receiver); err != nil {
+		return err
+	}
+
+	chain, err := blockchain.ContinueBlockChain(sender)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	tx, err := blockchain.NewTransaction(sender, receiver, amount, fee, lockTime, sequence, chain)
+	if err != nil {
+		return err
+	}
+
+	if err := (blockchain.Mempool{BlockChain: chain}).Add(tx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+	if lockTime != 0 || sequence != 0 {
+		fmt.Println("It stays in the mempool until its locktime and sequence allow it to be mined")
+	}
+	return nil
+}
+
+// monta a transação sem assinar e grava no arquivo, o endereço
+// de origem pode ser somente observado nesta carteira
+func (c *commandLine) createRawTx(sender, receiver string, amount, fee int, lockTime, sequence uint32, file string) error {
+	if err := wallet.ValidateAddress(receiver); err != nil {
+		return err
+	}
+
+	chain, err := blockchain.ContinueBlockChain(sender)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	ptx, err := blockchain.NewPartialTransaction(sender, receiver, amount, fee, chain)
+	if err != nil {
+		return err
+	}
+
+	if err := ptx.SetLocks(lockTime, sequence); err != nil {
+		return err
+	}
+
+	// os participantes precisam do script para saber quais chaves assinam
+	if ptx.IsMultisig() {
+		wallets, err := wallet.LoadWallets()
+		if err != nil {
+			return err
+		}
+		script, err := wallets.GetMultisig(sender)
+		if err != nil {
+			return fmt.Errorf("%w, add it with addmultisig first", err)
+		}
+		if err := ptx.SetMultisigScript(script); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := ptx.Serialize()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(file, encoded, 0600); err != nil {
+		return err
+	}
+
+	fmt.Println(ptx)
+	fmt.Printf("Unsigned transaction written to %s\n", file)
+	return nil
+}
+
+// assina a transação do arquivo somente com a carteira, sem abrir a blockchain,
+// nas transações multisig assina com cada chave do script que a carteira possui
+func (c *commandLine) signRawTx(in, out string) error {
+	ptx, err := readRawTx(in)
+	if err != nil {
+		return err
+	}
+
+	pubKeyHash, err := ptx.PublicKeyHash()
+	if err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	var signers []wallet.Wallet
+	if ptx.IsMultisig() {
+		script, err := ptx.MultisigScript()
+		if err != nil {
+			return err
+		}
+		signers = wallets.MultisigSigners(script)
+		if len(signers) == 0 {
+			return fmt.Errorf("%w: no key of %s is in the wallet", wallet.ErrWalletNotFound, script.Address())
+		}
+	} else {
+		w, err := wallets.GetWallet(wallet.AddressFromPublicKeyHash(pubKeyHash))
+		if err != nil {
+			return err
+		}
+		signers = append(signers, w)
+	}
+
+	for _, signer := range signers {
+		if err := ptx.Sign(signer.PrivateKey); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := ptx.Serialize()
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(out, encoded, 0600); err != nil {
+		return err
+	}
+
+	fmt.Println(ptx)
+	if signed, required := ptx.Signatures(); signed < required {
+		fmt.Printf("Partially signed transaction written to %s, %d more signature(s) needed\n", out, required-signed)
+		return nil
+	}
+	fmt.Printf("Signed transaction written to %s\n", out)
+	return nil
+}
+
+// verifica a transação assinada e a adiciona ao mempool
+func (c *commandLine) broadcastRawTx(in string) error {
+	ptx, err := readRawTx(in)
+	if err != nil {
+		return err
+	}
+
+	if err := ptx.Verify(); err != nil {
+		return err
+	}
+
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	tx := ptx.Transaction
+	if err := (blockchain.Mempool{BlockChain: chain}).Add(&tx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+	return nil
+}
+
+func readRawTx(file string) (*blockchain.PartialTransaction, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.DeserializePartialTransaction(content)
+}
+
+func (c *commandLine) mine(miner string) error {
+	if err := wallet.ValidateAddress(miner); err != nil {
+		return err
+	}
+
+	chain, err := blockchain.ContinueBlockChain(miner)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	block, err := chain.MinePending(context.Background(), miner)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Block %x mined at height %d with %d transaction(s)\n", block.Hash, block.Height, len(block.Transactions)-1)
+	return nil
+}
+
+func (c *commandLine) reindexUTXO() error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	UTXOSet := blockchain.UTXOSet{BlockChain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
+
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+	return nil
+}
+
+func (c *commandLine) getProof(txID string) error {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		return fmt.Errorf("invalid -txid: %w", err)
+	}
+
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	block, err := chain.FindBlockByTransaction(ID)
+	if err != nil {
+		return err
+	}
+
+	proof, err := block.MerkleProof(ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Block:      %x\n", block.Hash)
+	fmt.Printf("MerkleRoot: %x\n", block.MerkleRoot)
+	fmt.Println(proof)
+	fmt.Printf("Valid:      %v\n", proof.Verify(block.BlockHeader))
+	return nil
+}
+
+func (c *commandLine) verifyChain() error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	report, err := chain.Verify()
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+
+	if !report.Valid() {
+		return errInvalidChain
+	}
+	return nil
+}
+
+func (c *commandLine) supply() error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	height := chain.GetBestHeight()
+	circulating, err := blockchain.UTXOSet{BlockChain: chain}.TotalValue()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Height:         %d\n", height)
+	fmt.Printf("Block subsidy:  %d\n", blockchain.Subsidy(height+1))
+	fmt.Printf("Circulating:    %d\n", circulating)
+	fmt.Printf("Scheduled:      %d\n", blockchain.ScheduledSupply(height))
+	fmt.Printf("Max supply:     %d\n", blockchain.MaxSupply())
+	return nil
 }
 
-func (c *commandLine) send(sender, receiver string, amount int) {
-	if !wallet.ValidateAddress(sender) {
-		utils.HandleError(wallet.ErrInvalidAddress)
+func (c *commandLine) getChainTips() error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	tips, err := chain.ChainTips()
+	if err != nil {
+		return err
+	}
+
+	for _, tip := range tips {
+		fmt.Println(tip)
+	}
+	return nil
+}
+
+func (c *commandLine) startNode(port int, peers, miner string) error {
+	if miner != "" {
+		if err := wallet.ValidateAddress(miner); err != nil {
+			return err
+		}
+	}
+
+	chain, err := blockchain.OpenBlockChain(blockchain.DBPath)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	node := network.NewNode(fmt.Sprintf("localhost:%d", port), chain)
+	node.Miner = miner
+
+	if err := node.Listen(fmt.Sprintf(":%d", port)); err != nil {
+		return err
 	}
-	if !wallet.ValidateAddress(receiver) {
-		utils.HandleError(wallet.ErrInvalidAddress)
+
+	for _, peer := range strings.Split(peers, ",") {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		if err := node.Connect(peer); err != nil {
+			fmt.Printf("ERROR: could not connect to %s: %v\n", peer, err)
+		}
 	}
 
-	chain := blockchain.ContinueBlockChain(sender)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+
+	fmt.Println("Shutting down node...")
+	node.Close()
+	return nil
+}
+
+func (c *commandLine) rpcServer(listen, user, password string) error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	server := rpc.NewServer(chain, user, password)
+
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		<-interrupt
+
+		fmt.Println("Shutting down RPC server...")
+		chain.Close()
+		os.Exit(0)
+	}()
+
+	return server.ListenAndServe(listen)
+}
+
+func (c *commandLine) explorer(listen string) error {
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
 	defer chain.Close()
 
-	tx := blockchain.NewTransaction(sender, receiver, amount, chain)
-	chain.AddBlock([]*blockchain.Transaction{tx})
-	fmt.Println("SUCCESS!")
+	server := explorer.NewServer(chain)
+
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		<-interrupt
+
+		fmt.Println("Shutting down explorer...")
+		chain.Close()
+		os.Exit(0)
+	}()
+
+	return server.ListenAndServe(listen)
 }
 
-func (c *commandLine) listAddresses() {
-	wallets, _ := wallet.LoadWallets()
-	addresses := wallets.GetAddresses()
-	for index := range addresses {
-		fmt.Println(addresses[index])
+func (c *commandLine) listAddresses() error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
 	}
+
+	for _, address := range wallets.GetAllAddresses() {
+		fmt.Println(addressInfo(wallets, address))
+	}
+	return nil
 }
 
-func (c *commandLine) createWallet() {
-	wallets, _ := wallet.LoadWallets()
-	address, pvtKey := wallets.AddWallet()
-	wallets.SaveFile()
+func (c *commandLine) createWallet(withMnemonic bool) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	var mnemonic string
+	if withMnemonic {
+		if wallets.HD != nil {
+			return wallet.ErrSeedExists
+		}
+
+		mnemonic, err = wallet.NewMnemonic(wallet.DefaultEntropyBits)
+		if err != nil {
+			return err
+		}
+		seed, err := wallet.MnemonicToSeed(mnemonic, "")
+		if err != nil {
+			return err
+		}
+		if err := wallets.SetSeed(seed); err != nil {
+			return err
+		}
+	}
+
+	address, err := wallets.AddWallet()
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
 	fmt.Println("*********************************** WALLET ***********************************")
 	fmt.Printf("New address: %s\n", address)
-	fmt.Printf("Private Key: %s\n", strings.ToUpper(pvtKey))
+	if path := wallets.Wallets[address].Path; path != "" {
+		fmt.Printf("Path:        %s\n", path)
+	}
+	if mnemonic != "" {
+		fmt.Println()
+		fmt.Printf("Mnemonic:    %s\n", mnemonic)
+		fmt.Println("Write down these words and keep them safe, they restore every address of this wallet.")
+	}
+	return nil
+}
+
+// adiciona uma chave privada em hex, WIF ou PEM as carteiras e
+// procura os outputs não gastos do seu endereço
+func (c *commandLine) importPrivKey(key string, keyType wallet.KeyType, rescan bool) error {
+	privateKey, err := wallet.DecodePrivateKey(key, keyType)
+	if err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	address, added := wallets.ImportPrivateKey(privateKey)
+	if !added {
+		fmt.Printf("Address %s is already in the wallet\n", address)
+		return nil
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+	fmt.Printf("Imported address: %s\n", address)
+
+	if !rescan {
+		return nil
+	}
+	return c.rescan(address)
+}
+
+// procura na blockchain os outputs não gastos do endereço
+func (c *commandLine) rescan(address string) error {
+	chain, err := blockchain.ContinueBlockChain(address)
+	if errors.Is(err, blockchain.ErrChainNotFound) {
+		fmt.Println("No blockchain found, skipping the rescan")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	balance, outputs, err := addressBalance(chain, address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rescan found %d unspent output(s), balance of %s: %d\n", outputs, address, balance)
+	return nil
+}
+
+// adiciona um endereço somente observado, cuja chave privada fica fora do nó
+func (c *commandLine) importAddress(address, label string, rescan bool) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	added, err := wallets.AddWatchOnly(address)
+	if err != nil {
+		return err
+	}
+	if label != "" {
+		if err := wallets.SetLabel(address, label); err != nil {
+			return err
+		}
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	if !added {
+		fmt.Printf("Address %s is already watched\n", address)
+		return nil
+	}
+	fmt.Printf("Watching address: %s\n", address)
+
+	if !rescan {
+		return nil
+	}
+	return c.rescan(address)
+}
+
+func (c *commandLine) setLabel(address, label string) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.SetLabel(address, label); err != nil {
+		return err
+	}
+
+	return wallets.SaveFile()
+}
+
+func (c *commandLine) dumpPrivKey(address, format string) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	w, err := wallets.GetWallet(address)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "wif":
+		fmt.Println(wallet.EncodeWIF(w.PrivateKey))
+	case "hex":
+		fmt.Println(hex.EncodeToString(w.PrivateKey.D))
+	case "pem":
+		pemKey, err := wallet.PrivateKeyEncode(w.PrivateKey)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(pemKey))
+	default:
+		return fmt.Errorf("unknown format %q, expected wif, hex or pem", format)
+	}
+	return nil
+}
+
+// mostra a chave publica do endereço, que é compartilhada
+// com os outros participantes de um endereço multisig
+func (c *commandLine) getPubKey(address string) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	w, err := wallets.GetWallet(address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hex.EncodeToString(w.PublicKey))
+	return nil
+}
+
+// cria o endereço que exige m assinaturas das chaves informadas, cada chave
+// pode ser uma chave publica em hex ou um endereço desta carteira
+func (c *commandLine) addMultisig(m int, keys []string, label string) error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	var publicKeys [][]byte
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if w, err := wallets.GetWallet(key); err == nil {
+			publicKeys = append(publicKeys, w.PublicKey)
+			continue
+		}
+
+		publicKey, err := hex.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("%w: %q is neither a public key nor an address of this wallet", wallet.ErrInvalidKey, key)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	script, err := wallet.NewMultisigScript(m, publicKeys)
+	if err != nil {
+		return err
+	}
+
+	address, _ := wallets.AddMultisig(script)
+	if label != "" {
+		if err := wallets.SetLabel(address, label); err != nil {
+			return err
+		}
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Multisig address: %s\n", address)
+	fmt.Printf("Requires %d of %d signatures, the other signers get the same address with the same keys\n", script.M, len(script.PublicKeys))
+	return nil
+}
+
+// passa a gravar o arquivo de carteiras criptografado
+func (c *commandLine) encryptWallet() error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+	if wallets.IsEncrypted() {
+		return wallet.ErrEncrypted
+	}
+
+	passphrase, err := readNewPassphrase()
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.Encrypt(passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wallet file encrypted, type the passphrase when asked or set %s\n", passphraseEnv)
+	return nil
+}
+
+func (c *commandLine) changePassphrase() error {
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+	if !wallets.IsEncrypted() {
+		return wallet.ErrNotEncrypted
+	}
+
+	passphrase, err := readNewPassphrase()
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.ChangePassphrase(passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Println("Passphrase changed")
+	return nil
+}
+
+// deriva os endereços da frase mnemonica e adiciona os que ja
+// receberam algum output na blockchain
+func (c *commandLine) restoreWallet(mnemonic string, gapLimit int) error {
+	seed, err := wallet.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return err
+	}
+
+	chain, err := blockchain.ContinueBlockChain("")
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	used, err := chain.FindUsedPublicKeyHashes()
+	if err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets()
+	if err != nil {
+		return err
+	}
+
+	addresses, err := wallets.Restore(seed, gapLimit, func(publicKeyHash []byte) bool {
+		return used[hex.EncodeToString(publicKeyHash)]
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		fmt.Printf("%s %s\n", address, wallets.Wallets[address].Path)
+	}
+	fmt.Printf("Restored %d address(es), next index is %d\n", len(addresses), wallets.HD.NextIndex)
+	return nil
 }
 
 func (c *commandLine) Run() {
-	c.validate()
+	if err := c.configure(); err != nil {
+		exit(err)
+	}
+
+	blockchain.DefaultMiningOptions.OnHashrate = func(hashrate float64) {
+		fmt.Printf("\rMining: %.0f H/s", hashrate)
+	}
 
 	initBlockChainCmd := flag.NewFlagSet("init", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("print", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)
+	broadcastRawTxCmd := flag.NewFlagSet("broadcastrawtx", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	setLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	addMultisigCmd := flag.NewFlagSet("addmultisig", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	getProofCmd := flag.NewFlagSet("getproof", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	getChainTipsCmd := flag.NewFlagSet("getchaintips", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	rpcServerCmd := flag.NewFlagSet("rpcserver", flag.ExitOnError)
+	explorerCmd := flag.NewFlagSet("explorer", flag.ExitOnError)
 
 	initBlockChainAddress := initBlockChainCmd.String("address", "", "The address in BlockChain")
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address in BlockChain")
+	getBalanceLabel := getBalanceCmd.String("label", "", "Sum the balances of the wallet addresses with this label")
+	getBalanceAll := getBalanceCmd.Bool("all", false, "Sum the balances of every wallet address")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the miner")
+	sendLockTime := sendCmd.Uint("locktime", 0, "Block height, or unix time from 500000000 on, after which the transaction can be mined")
+	sendSequence := sendCmd.Uint("sequence", 0, "Blocks the spent outputs must be old, or 512 second units plus 4194304")
+	mineAddress := mineCmd.String("address", "", "The miner address")
+	createRawTxFrom := createRawTxCmd.String("from", "", "Source address, its private key is not needed")
+	createRawTxTo := createRawTxCmd.String("to", "", "Destination address")
+	createRawTxAmount := createRawTxCmd.Int("amount", 0, "Amount to send")
+	createRawTxFee := createRawTxCmd.Int("fee", 0, "Fee paid to the miner")
+	createRawTxLockTime := createRawTxCmd.Uint("locktime", 0, "Block height, or unix time from 500000000 on, after which the transaction can be mined")
+	createRawTxSequence := createRawTxCmd.Uint("sequence", 0, "Blocks the spent outputs must be old, or 512 second units plus 4194304")
+	createRawTxOut := createRawTxCmd.String("out", "", "The file the unsigned transaction is written to")
+	signRawTxIn := signRawTxCmd.String("in", "", "The unsigned transaction file")
+	signRawTxOut := signRawTxCmd.String("out", "", "The file the signed transaction is written to, defaults to -in")
+	broadcastRawTxIn := broadcastRawTxCmd.String("in", "", "The signed transaction file")
+	startNodePort := startNodeCmd.Int("port", c.config.Port, "The port the node listens on")
+	startNodePeers := startNodeCmd.String("peers", c.config.Peers, "Comma separated HOST:PORT of the peers to connect to")
+	startNodeMiner := startNodeCmd.String("miner", c.config.Miner, "Mine the received transactions paying the reward to this address")
+	explorerListen := explorerCmd.String("listen", c.config.ExplorerListen, "The HOST:PORT the explorer listens on")
+	rpcServerListen := rpcServerCmd.String("listen", c.config.RPCListen, "The HOST:PORT the JSON-RPC server listens on")
+	rpcServerUser := rpcServerCmd.String("user", c.config.RPCUser, "The basic auth user")
+	rpcServerPassword := rpcServerCmd.String("password", c.config.RPCPassword, "The basic auth password")
+	getProofTxID := getProofCmd.String("txid", "", "The transaction ID")
+	createWalletMnemonic := createWalletCmd.Bool("mnemonic", false, "Start an HD wallet from a new BIP39 recovery phrase")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "The BIP39 recovery phrase")
+	restoreWalletGap := restoreWalletCmd.Int("gap", wallet.DefaultGapLimit, "Stop after this many consecutive unused addresses")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "The private key in hex, WIF or PEM")
+	importPrivKeyFile := importPrivKeyCmd.String("file", "", "A file with the private key, such as a PEM file")
+	importPrivKeyUncompressed := importPrivKeyCmd.Bool("uncompressed", false, "Use the uncompressed public key for a hex key, as the old wallets did")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", true, "Look for the unspent outputs of the imported address")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	importAddressLabel := importAddressCmd.String("label", "", "The label of the address")
+	importAddressRescan := importAddressCmd.Bool("rescan", true, "Look for the unspent outputs of the address")
+	setLabelAddress := setLabelCmd.String("address", "", "The address in the wallet")
+	setLabelLabel := setLabelCmd.String("label", "", "The label of the address")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "The address in the wallet")
+	addMultisigM := addMultisigCmd.Int("m", 0, "The number of signatures required")
+	addMultisigKeys := addMultisigCmd.String("keys", "", "Comma separated public keys in hex or addresses of this wallet")
+	addMultisigLabel := addMultisigCmd.String("label", "", "The label of the multisig address")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "The address in the wallet")
+	dumpPrivKeyFormat := dumpPrivKeyCmd.String("format", "wif", "The output format: wif, hex or pem")
 
-	switch os.Args[1] {
+	switch c.args[0] {
 	case "init":
-		err := initBlockChainCmd.Parse(os.Args[2:])
+		err := initBlockChainCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	case "print":
-		err := printChainCmd.Parse(os.Args[2:])
+		err := printChainCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
+		err := sendCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "createrawtx":
+		err := createRawTxCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "signrawtx":
+		err := signRawTxCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "broadcastrawtx", "submitrawtx":
+		err := broadcastRawTxCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "mine":
+		err := mineCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
+		err := getBalanceCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
+		err := createWalletCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
+		err := listAddressesCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "importaddress":
+		err := importAddressCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "setlabel":
+		err := setLabelCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "getpubkey":
+		err := getPubKeyCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "addmultisig":
+		err := addMultisigCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "getproof":
+		err := getProofCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "verifychain":
+		err := verifyChainCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "supply":
+		err := supplyCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "getchaintips":
+		err := getChainTipsCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "startnode":
+		err := startNodeCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "rpcserver":
+		err := rpcServerCmd.Parse(c.args[1:])
+		utils.HandleError(err)
+
+	case "explorer":
+		err := explorerCmd.Parse(c.args[1:])
 		utils.HandleError(err)
 
 	default:
 		c.usage()
-		runtime.Goexit()
+		os.Exit(1)
 	}
 
+	var err error
+
 	if initBlockChainCmd.Parsed() {
-		c.init(*initBlockChainAddress)
+		err = c.init(*initBlockChainAddress)
 	}
 
 	if printChainCmd.Parsed() {
-		c.print()
+		err = c.print()
 	}
 
 	if sendCmd.Parsed() {
-		err := validateSend(*sendFrom, *sendTo, *sendAmount)
-		if  err != nil {
+		if err := validateSend(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendLockTime, *sendSequence); err != nil {
 			fmt.Println("ERROR: ", err.Error())
 			sendCmd.Usage()
-			runtime.Goexit()
+			os.Exit(1)
+		}
+		err = c.send(*sendFrom, *sendTo, *sendAmount, *sendFee, uint32(*sendLockTime), uint32(*sendSequence))
+	}
+
+	if createRawTxCmd.Parsed() {
+		if err := validateSend(*createRawTxFrom, *createRawTxTo, *createRawTxAmount, *createRawTxFee, *createRawTxLockTime, *createRawTxSequence); err != nil || *createRawTxOut == "" {
+			if err == nil {
+				err = errors.New("invalid -out file")
+			}
+			fmt.Println("ERROR: ", err.Error())
+			createRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.createRawTx(*createRawTxFrom, *createRawTxTo, *createRawTxAmount, *createRawTxFee, uint32(*createRawTxLockTime), uint32(*createRawTxSequence), *createRawTxOut)
+	}
+
+	if signRawTxCmd.Parsed() {
+		if *signRawTxIn == "" {
+			signRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		if *signRawTxOut == "" {
+			*signRawTxOut = *signRawTxIn
+		}
+		err = c.signRawTx(*signRawTxIn, *signRawTxOut)
+	}
+
+	if broadcastRawTxCmd.Parsed() {
+		if *broadcastRawTxIn == "" {
+			broadcastRawTxCmd.Usage()
+			os.Exit(1)
 		}
-		c.send(*sendFrom, *sendTo, *sendAmount)
+		err = c.broadcastRawTx(*broadcastRawTxIn)
+	}
+
+	if mineCmd.Parsed() {
+		if *mineAddress == "" {
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.mine(*mineAddress)
 	}
 
 	if getBalanceCmd.Parsed() {
-		c.getBalance(*getBalanceAddress)
+		options := 0
+		for _, set := range []bool{*getBalanceAddress != "", *getBalanceLabel != "", *getBalanceAll} {
+			if set {
+				options++
+			}
+		}
+		if options != 1 {
+			fmt.Println("ERROR: one of -address, -label or -all is required")
+			getBalanceCmd.Usage()
+			os.Exit(1)
+		}
+
+		if *getBalanceAddress != "" {
+			err = c.getBalance(*getBalanceAddress)
+		} else {
+			err = c.getWalletBalance(*getBalanceLabel)
+		}
 	}
 
 	if createWalletCmd.Parsed() {
-		c.createWallet()
+		err = c.createWallet(*createWalletMnemonic)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if strings.TrimSpace(*restoreWalletMnemonic) == "" || *restoreWalletGap <= 0 {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.restoreWallet(*restoreWalletMnemonic, *restoreWalletGap)
 	}
 
 	if listAddressesCmd.Parsed() {
-		c.listAddresses()
+		err = c.listAddresses()
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		if (*importPrivKeyKey == "") == (*importPrivKeyFile == "") {
+			fmt.Println("ERROR: either -key or -file is required")
+			importPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+
+		key := *importPrivKeyKey
+		if *importPrivKeyFile != "" {
+			content, readErr := ioutil.ReadFile(*importPrivKeyFile)
+			if readErr != nil {
+				exit(readErr)
+			}
+			key = string(content)
+		}
+
+		keyType := wallet.KeyCompressed
+		if *importPrivKeyUncompressed {
+			keyType = wallet.KeyUncompressed
+		}
+		err = c.importPrivKey(key, keyType, *importPrivKeyRescan)
+	}
+
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.importAddress(*importAddressAddress, *importAddressLabel, *importAddressRescan)
+	}
+
+	if setLabelCmd.Parsed() {
+		if *setLabelAddress == "" {
+			setLabelCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.setLabel(*setLabelAddress, *setLabelLabel)
+	}
+
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.getPubKey(*getPubKeyAddress)
+	}
+
+	if addMultisigCmd.Parsed() {
+		if *addMultisigM <= 0 || *addMultisigKeys == "" {
+			addMultisigCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.addMultisig(*addMultisigM, strings.Split(*addMultisigKeys, ","), *addMultisigLabel)
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.dumpPrivKey(*dumpPrivKeyAddress, *dumpPrivKeyFormat)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		err = c.encryptWallet()
+	}
+
+	if changePassphraseCmd.Parsed() {
+		err = c.changePassphrase()
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		err = c.reindexUTXO()
+	}
+
+	if getProofCmd.Parsed() {
+		if *getProofTxID == "" {
+			getProofCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.getProof(*getProofTxID)
+	}
+
+	if verifyChainCmd.Parsed() {
+		err = c.verifyChain()
+	}
+
+	if supplyCmd.Parsed() {
+		err = c.supply()
+	}
+
+	if getChainTipsCmd.Parsed() {
+		err = c.getChainTips()
+	}
+
+	if startNodeCmd.Parsed() {
+		err = c.startNode(*startNodePort, *startNodePeers, *startNodeMiner)
+	}
+
+	if explorerCmd.Parsed() {
+		err = c.explorer(*explorerListen)
+	}
+
+	if rpcServerCmd.Parsed() {
+		if *rpcServerUser == "" || *rpcServerPassword == "" {
+			fmt.Println("ERROR: -user and -password are required")
+			rpcServerCmd.Usage()
+			os.Exit(1)
+		}
+		err = c.rpcServer(*rpcServerListen, *rpcServerUser, *rpcServerPassword)
+	}
+
+	if err != nil {
+		exit(err)
 	}
 }
 
-func validateSend(from, to string, amount int) error {
+// unico ponto em que a CLI encerra o processo com erro
+func exit(err error) {
+	fmt.Println("ERROR:", err.Error())
+	os.Exit(1)
+}
+
+func validateSend(from, to string, amount, fee int, lockTime, sequence uint) error {
 	if strings.TrimSpace(from) == "" {
 		return errors.New("invalid -from address")
 	}
 	if strings.TrimSpace(to) == "" {
 		return errors.New("invalid -to address")
 	}
-	if amount <= 0 {
-		return fmt.Errorf("invalid -amount = %v", amount)
+	if err := blockchain.CheckAmount(amount, fee); err != nil {
+		return err
+	}
+	if lockTime > math.MaxUint32 {
+		return fmt.Errorf("invalid -locktime = %v", lockTime)
+	}
+	if sequence > math.MaxUint32 {
+		return fmt.Errorf("invalid -sequence = %v", sequence)
 	}
 	return nil
 }
+
+// lê a senha da variavel de ambiente ou, se ela não existir, do terminal
+func readPassphrase(env, prompt string) ([]byte, error) {
+	if value, ok := os.LookupEnv(env); ok {
+		return []byte(value), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w: set %s or run in a terminal", wallet.ErrPassphraseRequired, env)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// lê a nova senha, pedindo a confirmação quando ela vem do terminal
+func readNewPassphrase() ([]byte, error) {
+	if value, ok := os.LookupEnv(newPassphraseEnv); ok {
+		return []byte(value), nil
+	}
+
+	passphrase, err := readPassphrase(newPassphraseEnv, "New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	confirmation, err := readPassphrase(newPassphraseEnv, "Repeat the new passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"blockchain-tutorial/blockchain"
+	"blockchain-tutorial/network"
+	"blockchain-tutorial/wallet"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultDataDir = "./tmp"
+
+	// nome do arquivo de configuração dentro do datadir
+	FileName = "blockchain.conf"
+)
+
+// Config reúne as opções da linha de comando e do arquivo de configuração,
+// as flags tem precedencia sobre o arquivo
+type Config struct {
+	DataDir string
+	Network string
+
+	// opções do nó P2P
+	Port  int
+	Peers string
+	Miner string
+
+	// opções dos servidores JSON-RPC e explorer
+	RPCListen      string
+	RPCUser        string
+	RPCPassword    string
+	ExplorerListen string
+}
+
+func Default() Config {
+	return Config{DataDir: DefaultDataDir, Network: Mainnet.Name}
+}
+
+// caminho padrão do arquivo de configuração
+func (c Config) File() string {
+	return filepath.Join(c.DataDir, FileName)
+}
+
+// lê um arquivo no formato chave=valor, linhas em branco
+// e linhas iniciadas por # são ignoradas
+func (c *Config) LoadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for index, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		option := strings.SplitN(line, "=", 2)
+		if len(option) != 2 {
+			return fmt.Errorf("%s:%d: expected key=value", path, index+1)
+		}
+
+		key, value := strings.TrimSpace(option[0]), strings.TrimSpace(option[1])
+		if err := c.set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, index+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) set(key, value string) error {
+	switch key {
+	case "network":
+		c.Network = value
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		c.Port = port
+	case "peers":
+		c.Peers = value
+	case "miner":
+		c.Miner = value
+	case "rpclisten":
+		c.RPCListen = value
+	case "rpcuser":
+		c.RPCUser = value
+	case "rpcpassword":
+		c.RPCPassword = value
+	case "explorerlisten":
+		c.ExplorerListen = value
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// preenche as portas não configuradas com as da rede e aplica
+// o datadir e os parametros da rede aos pacotes da blockchain
+func (c *Config) Apply() error {
+	params, err := NetworkParams(c.Network)
+	if err != nil {
+		return err
+	}
+
+	if c.Port == 0 {
+		c.Port = params.Port
+	}
+	if c.RPCListen == "" {
+		c.RPCListen = fmt.Sprintf("localhost:%d", params.RPCPort)
+	}
+	if c.ExplorerListen == "" {
+		c.ExplorerListen = fmt.Sprintf("localhost:%d", params.ExplorerPort)
+	}
+
+	dir := filepath.Join(c.DataDir, params.Dir)
+
+	blockchain.DBPath = filepath.Join(dir, "blocks")
+	blockchain.GenesisData = params.GenesisData
+	blockchain.InitialDifficulty = params.Difficulty
+	blockchain.RetargetInterval = params.RetargetInterval
+
+	wallet.Version = params.AddressVersion
+	wallet.MultisigVersion = params.MultisigVersion
+	wallet.WIFVersion = params.WIFVersion
+	wallet.CoinType = params.CoinType
+	wallet.WalletFile = filepath.Join(dir, "wallets.data")
+
+	network.Network = params.Name
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrUnknownNetwork = errors.New("unknown network")
+)
+
+// Params são os parametros de uma rede, blockchains de redes
+// diferentes possuem genesis, endereços e portas diferentes
+type Params struct {
+	Name string
+
+	// mensagem gravada na coinbase do bloco genesis
+	GenesisData string
+
+	// primeiro byte dos endereços da rede
+	AddressVersion byte
+
+	// primeiro byte dos endereços multisig da rede
+	MultisigVersion byte
+
+	// primeiro byte das chaves privadas no formato WIF
+	WIFVersion byte
+
+	// tipo de moeda no caminho BIP44 das carteiras HD
+	CoinType uint32
+
+	// dificuldade do bloco genesis, em bits zero a esquerda
+	Difficulty int
+
+	// quantidade de blocos entre cada ajuste de dificuldade, zero desliga o ajuste
+	RetargetInterval int
+
+	// portas padrão do nó P2P, do servidor JSON-RPC e do explorer
+	Port         int
+	RPCPort      int
+	ExplorerPort int
+
+	// subdiretorio do datadir com os dados da rede
+	Dir string
+}
+
+var (
+	// a mainnet usa o datadir diretamente, mantendo as blockchains ja existentes
+	Mainnet = Params{
+		Name:             "mainnet",
+		GenesisData:      "First Transaction from Genesis",
+		AddressVersion:   0x00,
+		MultisigVersion:  0x05,
+		WIFVersion:       0x80,
+		CoinType:         0,
+		Difficulty:       14,
+		RetargetInterval: 10,
+		Port:             3000,
+		RPCPort:          8332,
+		ExplorerPort:     8080,
+		Dir:              "",
+	}
+
+	Testnet = Params{
+		Name:             "testnet",
+		GenesisData:      "First Transaction from Testnet Genesis",
+		AddressVersion:   0x6f,
+		MultisigVersion:  0xc4,
+		WIFVersion:       0xef,
+		CoinType:         1,
+		Difficulty:       10,
+		RetargetInterval: 10,
+		Port:             13000,
+		RPCPort:          18332,
+		ExplorerPort:     18080,
+		Dir:              "testnet",
+	}
+
+	// rede local com dificuldade trivial e sem ajuste, para testes
+	Regtest = Params{
+		Name:             "regtest",
+		GenesisData:      "First Transaction from Regtest Genesis",
+		AddressVersion:   0x7a,
+		MultisigVersion:  0x7b,
+		WIFVersion:       0xef,
+		CoinType:         1,
+		Difficulty:       1,
+		RetargetInterval: 0,
+		Port:             23000,
+		RPCPort:          28332,
+		ExplorerPort:     28080,
+		Dir:              "regtest",
+	}
+
+	Networks = map[string]Params{
+		Mainnet.Name: Mainnet,
+		Testnet.Name: Testnet,
+		Regtest.Name: Regtest,
+	}
+)
+
+// retorna os parametros da rede pelo nome
+func NetworkParams(name string) (Params, error) {
+	params, ok := Networks[name]
+	if !ok {
+		return Params{}, fmt.Errorf("%w %q, expected one of %v", ErrUnknownNetwork, name, NetworkNames())
+	}
+	return params, nil
+}
+
+// nomes das redes conhecidas em ordem alfabetica
+func NetworkNames() []string {
+	var names []string
+	for name := range Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,463 @@
+package explorer
+
+import (
+	"blockchain-tutorial/blockchain"
+	"blockchain-tutorial/rpc"
+	"blockchain-tutorial/wallet"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// quantidade de blocos listados na pagina inicial
+	DefaultBlocksLimit = 20
+	MaxBlocksLimit     = 500
+)
+
+var (
+	ErrBlockNotFound       = errors.New("block not found")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidHash         = errors.New("invalid hash")
+	ErrInvalidHeight       = errors.New("invalid height")
+)
+
+// HistoryEntry é uma transação que envolve o endereço,
+// com os valores recebidos e gastos por ele
+type HistoryEntry struct {
+	TxID      string `json:"txid"`
+	BlockHash string `json:"blockhash"`
+	Height    int    `json:"height"`
+	Time      int64  `json:"time"`
+	Received  int    `json:"received"`
+	Sent      int    `json:"sent"`
+}
+
+type AddressResult struct {
+	Address      string         `json:"address"`
+	Balance      int            `json:"balance"`
+	Received     int            `json:"received"`
+	Sent         int            `json:"sent"`
+	Transactions []HistoryEntry `json:"transactions"`
+}
+
+type IndexResult struct {
+	Height  int               `json:"height"`
+	Mempool int               `json:"mempool"`
+	Blocks  []rpc.BlockResult `json:"blocks"`
+}
+
+// Server expõe a blockchain em uma API REST em /api
+// e em paginas HTML para serem navegadas no browser
+type Server struct {
+	Chain  *blockchain.BlockChain
+	Logger *log.Logger
+
+	pages map[string]*template.Template
+}
+
+func NewServer(chain *blockchain.BlockChain) *Server {
+	return &Server{
+		Chain:  chain,
+		Logger: log.New(os.Stdout, "[explorer] ", log.LstdFlags),
+		pages:  parsePages(),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/blocks", s.apiBlocks)
+	mux.HandleFunc("/api/block/", s.apiBlock)
+	mux.HandleFunc("/api/block-height/", s.apiBlockHeight)
+	mux.HandleFunc("/api/tx/", s.apiTransaction)
+	mux.HandleFunc("/api/address/", s.apiAddress)
+
+	mux.HandleFunc("/", s.indexPage)
+	mux.HandleFunc("/block/", s.blockPage)
+	mux.HandleFunc("/block-height/", s.blockHeightPage)
+	mux.HandleFunc("/tx/", s.transactionPage)
+	mux.HandleFunc("/address/", s.addressPage)
+	mux.HandleFunc("/search", s.search)
+
+	return mux
+}
+
+func (s *Server) ListenAndServe(address string) error {
+	s.Logger.Printf("listening on http://%s", address)
+	return http.ListenAndServe(address, s.Handler())
+}
+
+// ultimos blocos da blockchain principal, do mais recente para o mais antigo
+func (s *Server) index(limit int) (IndexResult, error) {
+	count, err := blockchain.Mempool{BlockChain: s.Chain}.Count()
+	if err != nil {
+		return IndexResult{}, err
+	}
+
+	result := IndexResult{
+		Height:  s.Chain.GetBestHeight(),
+		Mempool: count,
+		Blocks:  []rpc.BlockResult{},
+	}
+
+	if result.Height < 0 {
+		return result, nil
+	}
+
+	it := s.Chain.Iterator()
+	for len(result.Blocks) < limit {
+		block, err := it.Next()
+		if err != nil {
+			return IndexResult{}, err
+		}
+		result.Blocks = append(result.Blocks, rpc.NewBlockResult(s.Chain, block))
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Server) findBlock(hash string) (rpc.BlockResult, error) {
+	ID, err := hex.DecodeString(hash)
+	if err != nil || len(ID) == 0 {
+		return rpc.BlockResult{}, ErrInvalidHash
+	}
+
+	block, err := s.Chain.GetBlock(ID)
+	if errors.Is(err, blockchain.ErrBlockNotFound) {
+		return rpc.BlockResult{}, ErrBlockNotFound
+	}
+	if err != nil {
+		return rpc.BlockResult{}, err
+	}
+
+	return rpc.NewBlockResult(s.Chain, block), nil
+}
+
+func (s *Server) findBlockHash(height string) (string, error) {
+	value, err := strconv.Atoi(height)
+	if err != nil || value < 0 {
+		return "", ErrInvalidHeight
+	}
+
+	hash, err := s.Chain.GetBlockHash(value)
+	if err != nil {
+		return "", ErrBlockNotFound
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// procura a transação no mempool e depois na blockchain
+func (s *Server) findTransaction(txID string) (rpc.TransactionResult, error) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil || len(ID) == 0 {
+		return rpc.TransactionResult{}, ErrInvalidHash
+	}
+
+	tx, err := (blockchain.Mempool{BlockChain: s.Chain}).FindTransaction(ID)
+	if err == nil {
+		return rpc.NewTransactionResult(tx), nil
+	}
+	if !errors.Is(err, blockchain.ErrTxNotFound) {
+		return rpc.TransactionResult{}, err
+	}
+
+	block, err := s.Chain.FindBlockByTransaction(ID)
+	if errors.Is(err, blockchain.ErrTxNotFound) {
+		return rpc.TransactionResult{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return rpc.TransactionResult{}, err
+	}
+
+	for _, tx := range block.Transactions {
+		if bytes.Equal(tx.ID, ID) {
+			result := rpc.NewTransactionResult(tx)
+			result.BlockHash = hex.EncodeToString(block.Hash)
+			result.Confirmations = s.Chain.GetBestHeight() - block.Height + 1
+			return result, nil
+		}
+	}
+
+	return rpc.TransactionResult{}, ErrTransactionNotFound
+}
+
+// retorna o saldo do endereço e as transações que o envolvem,
+// percorrendo a blockchain do genesis até o ultimo bloco
+func (s *Server) findAddress(address string) (AddressResult, error) {
+	pubKeyHash, err := wallet.PublicKeyHashFromAddress(address)
+	if err != nil {
+		return AddressResult{}, wallet.ErrInvalidAddress
+	}
+
+	result := AddressResult{Address: address, Transactions: []HistoryEntry{}}
+
+	UTXOs, err := (blockchain.UTXOSet{BlockChain: s.Chain}).FindUTXO(pubKeyHash)
+	if err != nil {
+		return AddressResult{}, err
+	}
+	for _, out := range UTXOs {
+		result.Balance += out.Value
+	}
+
+	hashes, err := s.Chain.GetBlockHashes()
+	if err != nil {
+		return AddressResult{}, err
+	}
+
+	// outputs do endereço, para descobrir o valor gasto pelos inputs
+	owned := make(map[string]int)
+
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := s.Chain.GetBlock(hashes[i])
+		if err != nil {
+			return AddressResult{}, err
+		}
+
+		for _, tx := range block.Transactions {
+			entry := HistoryEntry{
+				TxID:      hex.EncodeToString(tx.ID),
+				BlockHash: hex.EncodeToString(block.Hash),
+				Height:    block.Height,
+				Time:      block.Timestamp,
+			}
+
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Inputs {
+					entry.Sent += owned[fmt.Sprintf("%x:%d", in.ID, in.Out)]
+				}
+			}
+
+			for index, out := range tx.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					entry.Received += out.Value
+					owned[fmt.Sprintf("%x:%d", tx.ID, index)] = out.Value
+				}
+			}
+
+			if entry.Received > 0 || entry.Sent > 0 {
+				result.Received += entry.Received
+				result.Sent += entry.Sent
+				result.Transactions = append(result.Transactions, entry)
+			}
+		}
+	}
+
+	// as mais recentes primeiro
+	for i, j := 0, len(result.Transactions)-1; i < j; i, j = i+1, j-1 {
+		result.Transactions[i], result.Transactions[j] = result.Transactions[j], result.Transactions[i]
+	}
+
+	return result, nil
+}
+
+func statusCode(err error) int {
+	switch err {
+	case ErrBlockNotFound, ErrTransactionNotFound:
+		return http.StatusNotFound
+	case ErrInvalidHash, ErrInvalidHeight, wallet.ErrInvalidAddress:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func pathParam(r *http.Request, prefix string) string {
+	return strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		s.Logger.Printf("write response: %v", err)
+	}
+}
+
+func (s *Server) writeJSONError(w http.ResponseWriter, err error) {
+	s.writeJSON(w, statusCode(err), map[string]string{"error": err.Error()})
+}
+
+func (s *Server) apiBlocks(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultBlocksLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > MaxBlocksLimit {
+			s.writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("limit must be between 1 and %d", MaxBlocksLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	result, err := s.index(limit)
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) apiBlock(w http.ResponseWriter, r *http.Request) {
+	block, err := s.findBlock(pathParam(r, "/api/block/"))
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, block)
+}
+
+func (s *Server) apiBlockHeight(w http.ResponseWriter, r *http.Request) {
+	hash, err := s.findBlockHash(pathParam(r, "/api/block-height/"))
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	block, err := s.findBlock(hash)
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, block)
+}
+
+func (s *Server) apiTransaction(w http.ResponseWriter, r *http.Request) {
+	tx, err := s.findTransaction(pathParam(r, "/api/tx/"))
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, tx)
+}
+
+func (s *Server) apiAddress(w http.ResponseWriter, r *http.Request) {
+	address, err := s.findAddress(pathParam(r, "/api/address/"))
+	if err != nil {
+		s.writeJSONError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, address)
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, page string, data interface{}) {
+	var buffer bytes.Buffer
+
+	if err := s.pages[page].ExecuteTemplate(&buffer, "layout", data); err != nil {
+		s.Logger.Printf("render %s: %v", page, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buffer.WriteTo(w)
+}
+
+func (s *Server) renderError(w http.ResponseWriter, err error) {
+	s.render(w, statusCode(err), "error", err.Error())
+}
+
+func (s *Server) indexPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		s.render(w, http.StatusNotFound, "error", "page not found")
+		return
+	}
+
+	result, err := s.index(DefaultBlocksLimit)
+	if err != nil {
+		s.renderError(w, err)
+		return
+	}
+
+	s.render(w, http.StatusOK, "index", result)
+}
+
+func (s *Server) blockPage(w http.ResponseWriter, r *http.Request) {
+	block, err := s.findBlock(pathParam(r, "/block/"))
+	if err != nil {
+		s.renderError(w, err)
+		return
+	}
+
+	s.render(w, http.StatusOK, "block", block)
+}
+
+func (s *Server) blockHeightPage(w http.ResponseWriter, r *http.Request) {
+	hash, err := s.findBlockHash(pathParam(r, "/block-height/"))
+	if err != nil {
+		s.renderError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/block/"+hash, http.StatusFound)
+}
+
+func (s *Server) transactionPage(w http.ResponseWriter, r *http.Request) {
+	tx, err := s.findTransaction(pathParam(r, "/tx/"))
+	if err != nil {
+		s.renderError(w, err)
+		return
+	}
+
+	s.render(w, http.StatusOK, "transaction", tx)
+}
+
+func (s *Server) addressPage(w http.ResponseWriter, r *http.Request) {
+	address, err := s.findAddress(pathParam(r, "/address/"))
+	if err != nil {
+		s.renderError(w, err)
+		return
+	}
+
+	s.render(w, http.StatusOK, "address", address)
+}
+
+// redireciona para o bloco, transação ou endereço pesquisado
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if _, err := strconv.Atoi(query); err == nil {
+		http.Redirect(w, r, "/block-height/"+query, http.StatusFound)
+		return
+	}
+
+	if _, err := s.findBlock(query); err == nil {
+		http.Redirect(w, r, "/block/"+query, http.StatusFound)
+		return
+	}
+
+	if _, err := s.findTransaction(query); err == nil {
+		http.Redirect(w, r, "/tx/"+query, http.StatusFound)
+		return
+	}
+
+	if wallet.ValidateAddress(query) == nil {
+		http.Redirect(w, r, "/address/"+query, http.StatusFound)
+		return
+	}
+
+	s.render(w, http.StatusNotFound, "error", fmt.Sprintf("nothing found for %q", query))
+}
@@ -0,0 +1,139 @@
+package explorer
+
+import (
+	"html/template"
+	"time"
+)
+
+// todas as paginas são renderizadas dentro do layout
+const layoutTemplate = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Blockchain Explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+a { color: #0645ad; text-decoration: none; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px; text-align: left; }
+th { background: #f4f4f4; }
+.hash { font-family: monospace; word-break: break-all; }
+header { display: flex; justify-content: space-between; align-items: center; }
+</style>
+</head>
+<body>
+<header>
+<h1><a href="/">Blockchain Explorer</a></h1>
+<form action="/search"><input name="q" size="50" placeholder="block height, block hash, transaction ID or address"> <button>Search</button></form>
+</header>
+{{template "content" .}}
+</body>
+</html>{{end}}`
+
+const indexTemplate = `{{define "content"}}
+<p>Height: {{.Height}} &middot; Pending transactions: {{.Mempool}}</p>
+<h2>Latest blocks</h2>
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th>Transactions</th></tr>
+{{range .Blocks}}<tr>
+<td><a href="/block/{{.Hash}}">{{.Height}}</a></td>
+<td class="hash"><a href="/block/{{.Hash}}">{{.Hash}}</a></td>
+<td>{{time .Timestamp}}</td>
+<td>{{len .Transactions}}</td>
+</tr>{{end}}
+</table>
+{{end}}`
+
+const blockTemplate = `{{define "content"}}
+<h2>Block {{.Height}}</h2>
+<table>
+<tr><th>Hash</th><td class="hash">{{.Hash}}</td></tr>
+<tr><th>Confirmations</th><td>{{if lt .Confirmations 0}}not in the main chain{{else}}{{.Confirmations}}{{end}}</td></tr>
+<tr><th>Previous block</th><td class="hash">{{if .PrevHash}}<a href="/block/{{.PrevHash}}">{{.PrevHash}}</a>{{else}}genesis{{end}}</td></tr>
+<tr><th>Time</th><td>{{time .Timestamp}}</td></tr>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Merkle root</th><td class="hash">{{.MerkleRoot}}</td></tr>
+<tr><th>Bits</th><td>{{.Bits}}</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+</table>
+<h2>Transactions</h2>
+<table>
+{{range .Transactions}}<tr><td class="hash"><a href="/tx/{{.}}">{{.}}</a></td></tr>{{end}}
+</table>
+{{end}}`
+
+const transactionTemplate = `{{define "content"}}
+<h2>Transaction</h2>
+<table>
+<tr><th>ID</th><td class="hash">{{.TxID}}</td></tr>
+<tr><th>Block</th><td class="hash">{{if .BlockHash}}<a href="/block/{{.BlockHash}}">{{.BlockHash}}</a>{{else}}pending in the mempool{{end}}</td></tr>
+<tr><th>Confirmations</th><td>{{.Confirmations}}</td></tr>
+</table>
+<h2>Inputs</h2>
+<table>
+{{if .Coinbase}}<tr><td>Coinbase</td></tr>
+{{else}}<tr><th>Previous output</th></tr>
+{{range .Inputs}}<tr><td class="hash"><a href="/tx/{{.TxID}}">{{.TxID}}</a>:{{.Out}}</td></tr>{{end}}
+{{end}}
+</table>
+<h2>Outputs</h2>
+<table>
+<tr><th>#</th><th>Address</th><th>Value</th></tr>
+{{range $index, $out := .Outputs}}<tr>
+<td>{{$index}}</td>
+<td class="hash"><a href="/address/{{$out.Address}}">{{$out.Address}}</a></td>
+<td>{{$out.Value}}</td>
+</tr>{{end}}
+</table>
+{{end}}`
+
+const addressTemplate = `{{define "content"}}
+<h2>Address</h2>
+<table>
+<tr><th>Address</th><td class="hash">{{.Address}}</td></tr>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+<tr><th>Total received</th><td>{{.Received}}</td></tr>
+<tr><th>Total sent</th><td>{{.Sent}}</td></tr>
+</table>
+<h2>Transactions</h2>
+<table>
+<tr><th>Height</th><th>Transaction</th><th>Time</th><th>Received</th><th>Sent</th></tr>
+{{range .Transactions}}<tr>
+<td><a href="/block/{{.BlockHash}}">{{.Height}}</a></td>
+<td class="hash"><a href="/tx/{{.TxID}}">{{.TxID}}</a></td>
+<td>{{time .Time}}</td>
+<td>{{.Received}}</td>
+<td>{{.Sent}}</td>
+</tr>{{end}}
+</table>
+{{end}}`
+
+const errorTemplate = `{{define "content"}}
+<h2>Error</h2>
+<p>{{.}}</p>
+{{end}}`
+
+var templateFuncs = template.FuncMap{
+	"time": func(timestamp int64) string {
+		return time.Unix(timestamp, 0).Format(time.RFC3339)
+	},
+}
+
+func parsePages() map[string]*template.Template {
+	layout := template.Must(template.New("layout").Funcs(templateFuncs).Parse(layoutTemplate))
+
+	pages := map[string]string{
+		"index":       indexTemplate,
+		"block":       blockTemplate,
+		"transaction": transactionTemplate,
+		"address":     addressTemplate,
+		"error":       errorTemplate,
+	}
+
+	parsed := make(map[string]*template.Template)
+	for name, page := range pages {
+		parsed[name] = template.Must(template.Must(layout.Clone()).Parse(page))
+	}
+
+	return parsed
+}
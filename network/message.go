@@ -0,0 +1,82 @@
+package network
+
+import (
+	"blockchain-tutorial/blockchain"
+	"bytes"
+	"encoding/gob"
+)
+
+const (
+	// versão do protocolo, nós com versões diferentes não se conectam
+	ProtocolVersion = 1
+
+	cmdVersion = "version"
+	// confirma o recebimento da Version, não possui payload
+	cmdVerack = "verack"
+	// pede os hashes de todos os blocos do nó, não possui payload
+	cmdGetBlocks = "getblocks"
+	cmdInv       = "inv"
+	cmdGetData   = "getdata"
+	cmdBlock     = "block"
+	cmdTx        = "tx"
+
+	invBlock = "block"
+	invTx    = "tx"
+)
+
+var (
+	// nome da rede do nó, nós de redes diferentes não se conectam
+	Network = "mainnet"
+)
+
+// Message é o envelope de todas as mensagens trocadas entre os nós
+type Message struct {
+	Command string
+	Payload []byte
+}
+
+// Version é a primeira mensagem enviada em uma conexão,
+// com ela os nós trocam a altura de suas blockchains
+type Version struct {
+	Version    int
+	Network    string
+	BestHeight int
+	AddrFrom   string
+}
+
+// Inv anuncia blocos ou transações que o nó possui
+type Inv struct {
+	Type  string
+	Items [][]byte
+}
+
+// GetData pede um bloco ou transação anunciado com Inv
+type GetData struct {
+	Type string
+	ID   []byte
+}
+
+type BlockMessage struct {
+	Block *blockchain.Block
+}
+
+type TxMessage struct {
+	Transaction *blockchain.Transaction
+}
+
+func newMessage(command string, payload interface{}) (Message, error) {
+	if payload == nil {
+		return Message{Command: command}, nil
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(payload); err != nil {
+		return Message{}, err
+	}
+
+	return Message{Command: command, Payload: buffer.Bytes()}, nil
+}
+
+func (m Message) decode(payload interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(m.Payload)).Decode(payload)
+}
@@ -0,0 +1,607 @@
+package network
+
+import (
+	"blockchain-tutorial/blockchain"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+var (
+	ErrNodeClosed = errors.New("node is closed")
+)
+
+// Node é um nó da rede P2P, ele mantém conexões TCP com outros nós
+// e sincroniza os blocos e transações da BlockChain com eles
+type Node struct {
+	// endereço anunciado aos outros nós
+	Address string
+
+	// quando informado, o nó minera as transações recebidas
+	// pagando a recompensa para este endereço
+	Miner string
+
+	Chain  *blockchain.BlockChain
+	Logger *log.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	peers    map[*peer]bool
+	mining   context.CancelFunc
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type peer struct {
+	conn    net.Conn
+	encoder *gob.Encoder
+	mu      sync.Mutex
+
+	// preenchidos ao receber a mensagem Version
+	addr        string
+	height      int
+	version     int
+	versionSent bool
+
+	// blocos anunciados pelo nó que ainda serão pedidos a ele, um de cada vez
+	inTransit [][]byte
+}
+
+func (p *peer) send(command string, payload interface{}) error {
+	message, err := newMessage(command, payload)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.encoder.Encode(message)
+}
+
+// indica se o nó ja enviou a mensagem Version
+func (p *peer) ready() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.version != 0
+}
+
+// adiciona a fila os blocos que ainda não estão nela
+func (p *peer) queueBlocks(hashes [][]byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	queued := make(map[string]bool)
+	for _, hash := range p.inTransit {
+		queued[string(hash)] = true
+	}
+
+	for _, hash := range hashes {
+		if !queued[string(hash)] {
+			queued[string(hash)] = true
+			p.inTransit = append(p.inTransit, hash)
+		}
+	}
+}
+
+// retira o proximo bloco da fila, nil quando ela esta vazia
+func (p *peer) nextBlock() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.inTransit) == 0 {
+		return nil
+	}
+
+	hash := p.inTransit[0]
+	p.inTransit = p.inTransit[1:]
+	return hash
+}
+
+// indica se ainda há blocos a receber do nó
+func (p *peer) syncing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.inTransit) > 0
+}
+
+func (p *peer) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.addr != "" {
+		return p.addr
+	}
+	return p.conn.RemoteAddr().String()
+}
+
+func NewNode(address string, chain *blockchain.BlockChain) *Node {
+	return &Node{
+		Address: address,
+		Chain:   chain,
+		Logger:  log.New(os.Stdout, fmt.Sprintf("[%s] ", address), log.LstdFlags),
+		peers:   make(map[*peer]bool),
+	}
+}
+
+// começa a aceitar conexões de outros nós no endereço informado
+func (n *Node) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.listener = listener
+	n.mu.Unlock()
+
+	n.Logger.Printf("listening on %s", listener.Addr())
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			n.handle(conn)
+		}
+	}()
+
+	return nil
+}
+
+// conecta a outro nó e inicia o handshake
+func (n *Node) Connect(address string) error {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	p := n.handle(conn)
+	if p == nil {
+		return ErrNodeClosed
+	}
+
+	return n.sendVersion(p)
+}
+
+func (n *Node) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	if n.listener != nil {
+		n.listener.Close()
+	}
+	if n.mining != nil {
+		n.mining()
+	}
+	for p := range n.peers {
+		p.conn.Close()
+	}
+	n.mu.Unlock()
+
+	n.wg.Wait()
+	return nil
+}
+
+// retorna os endereços dos nós conectados
+func (n *Node) Peers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var addresses []string
+	for p := range n.peers {
+		addresses = append(addresses, p.String())
+	}
+	return addresses
+}
+
+// adiciona a transação ao mempool e anuncia para os outros nós
+func (n *Node) SendTransaction(tx *blockchain.Transaction) error {
+	if err := (blockchain.Mempool{BlockChain: n.Chain}).Add(tx); err != nil {
+		return err
+	}
+
+	n.broadcast(nil, cmdInv, Inv{Type: invTx, Items: [][]byte{tx.ID}})
+	n.mine()
+	return nil
+}
+
+func (n *Node) handle(conn net.Conn) *peer {
+	p := &peer{conn: conn, encoder: gob.NewEncoder(conn), height: -1}
+
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	n.peers[p] = true
+	n.mu.Unlock()
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer n.disconnect(p)
+
+		decoder := gob.NewDecoder(conn)
+		for {
+			var msg Message
+			if err := decoder.Decode(&msg); err != nil {
+				if err != io.EOF {
+					n.Logger.Printf("peer %s: %v", p, err)
+				}
+				return
+			}
+
+			if err := n.process(p, msg); err != nil {
+				n.Logger.Printf("peer %s: %s: %v", p, msg.Command, err)
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+func (n *Node) disconnect(p *peer) {
+	p.conn.Close()
+
+	n.mu.Lock()
+	delete(n.peers, p)
+	n.mu.Unlock()
+
+	// a mineração pode estar esperando os blocos deste nó
+	n.mine()
+}
+
+// envia a mensagem para todos os nós com handshake completo, exceto from
+func (n *Node) broadcast(from *peer, command string, payload interface{}) {
+	n.mu.Lock()
+	var peers []*peer
+	for p := range n.peers {
+		if p != from && p.ready() {
+			peers = append(peers, p)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, p := range peers {
+		if err := p.send(command, payload); err != nil {
+			n.Logger.Printf("peer %s: %v", p, err)
+		}
+	}
+}
+
+func (n *Node) sendVersion(p *peer) error {
+	p.mu.Lock()
+	p.versionSent = true
+	p.mu.Unlock()
+
+	return p.send(cmdVersion, Version{
+		Version:    ProtocolVersion,
+		Network:    Network,
+		BestHeight: n.Chain.GetBestHeight(),
+		AddrFrom:   n.Address,
+	})
+}
+
+func (n *Node) process(p *peer, msg Message) error {
+	if msg.Command != cmdVersion && !p.ready() {
+		return fmt.Errorf("unexpected message before version")
+	}
+
+	switch msg.Command {
+	case cmdVersion:
+		var payload Version
+		if err := msg.decode(&payload); err != nil {
+			return err
+		}
+		return n.handleVersion(p, payload)
+
+	case cmdVerack:
+		return n.handleVerack(p)
+
+	case cmdGetBlocks:
+		hashes, err := n.Chain.GetBlockHashes()
+		if err != nil {
+			return err
+		}
+		return p.send(cmdInv, Inv{Type: invBlock, Items: hashes})
+
+	case cmdInv:
+		var payload Inv
+		if err := msg.decode(&payload); err != nil {
+			return err
+		}
+		return n.handleInv(p, payload)
+
+	case cmdGetData:
+		var payload GetData
+		if err := msg.decode(&payload); err != nil {
+			return err
+		}
+		return n.handleGetData(p, payload)
+
+	case cmdBlock:
+		var payload BlockMessage
+		if err := msg.decode(&payload); err != nil {
+			return err
+		}
+		return n.handleBlock(p, payload)
+
+	case cmdTx:
+		var payload TxMessage
+		if err := msg.decode(&payload); err != nil {
+			return err
+		}
+		return n.handleTx(p, payload)
+
+	default:
+		n.Logger.Printf("peer %s: unknown command %q", p, msg.Command)
+	}
+
+	return nil
+}
+
+func (n *Node) handleVersion(p *peer, payload Version) error {
+	if payload.Version != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", payload.Version)
+	}
+	if payload.Network != Network {
+		return fmt.Errorf("peer is on network %q, expected %q", payload.Network, Network)
+	}
+
+	p.mu.Lock()
+	p.version = payload.Version
+	p.height = payload.BestHeight
+	p.addr = payload.AddrFrom
+	versionSent := p.versionSent
+	p.mu.Unlock()
+
+	if !versionSent {
+		if err := n.sendVersion(p); err != nil {
+			return err
+		}
+	}
+
+	if err := p.send(cmdVerack, nil); err != nil {
+		return err
+	}
+
+	// o nó conectado possui blocos que este nó não tem
+	if payload.BestHeight > n.Chain.GetBestHeight() {
+		return p.send(cmdGetBlocks, nil)
+	}
+
+	return nil
+}
+
+// após o handshake as transações pendentes são anunciadas ao nó
+func (n *Node) handleVerack(p *peer) error {
+	p.mu.Lock()
+	height := p.height
+	p.mu.Unlock()
+
+	n.Logger.Printf("connected to %s at height %d", p, height)
+
+	txs, err := (blockchain.Mempool{BlockChain: n.Chain}).Transactions()
+	if err != nil {
+		return err
+	}
+
+	var items [][]byte
+	for _, tx := range txs {
+		items = append(items, tx.ID)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	return p.send(cmdInv, Inv{Type: invTx, Items: items})
+}
+
+func (n *Node) handleInv(p *peer, payload Inv) error {
+	switch payload.Type {
+	case invBlock:
+		var missing [][]byte
+
+		// os hashes chegam do ultimo bloco até o genesis,
+		// então são baixados na ordem inversa
+		for i := len(payload.Items) - 1; i >= 0; i-- {
+			if !n.Chain.HasBlock(payload.Items[i]) {
+				missing = append(missing, payload.Items[i])
+			}
+		}
+
+		p.queueBlocks(missing)
+		return n.requestNextBlock(p)
+
+	case invTx:
+		mempool := blockchain.Mempool{BlockChain: n.Chain}
+
+		for _, ID := range payload.Items {
+			_, err := mempool.FindTransaction(ID)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, blockchain.ErrTxNotFound) {
+				return err
+			}
+			if err := p.send(cmdGetData, GetData{Type: invTx, ID: ID}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *Node) requestNextBlock(p *peer) error {
+	hash := p.nextBlock()
+	if hash == nil {
+		return nil
+	}
+
+	return p.send(cmdGetData, GetData{Type: invBlock, ID: hash})
+}
+
+// indica se algum nó ainda esta enviando blocos
+func (n *Node) syncing() bool {
+	for p := range n.peers {
+		if p.syncing() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) handleGetData(p *peer, payload GetData) error {
+	switch payload.Type {
+	case invBlock:
+		block, err := n.Chain.GetBlock(payload.ID)
+		if err != nil {
+			return nil
+		}
+		return p.send(cmdBlock, BlockMessage{Block: block})
+
+	case invTx:
+		tx, err := blockchain.Mempool{BlockChain: n.Chain}.FindTransaction(payload.ID)
+		if err != nil {
+			return nil
+		}
+		return p.send(cmdTx, TxMessage{Transaction: tx})
+	}
+
+	return nil
+}
+
+func (n *Node) handleBlock(p *peer, payload BlockMessage) error {
+	block := payload.Block
+	if block == nil {
+		return fmt.Errorf("empty block message")
+	}
+
+	err := n.Chain.AcceptBlock(block)
+
+	switch {
+	case err == nil && !bytes.Equal(block.Hash, n.Chain.LastHash()):
+		// bloco de um ramo paralelo com menos trabalho que a blockchain principal
+		n.Logger.Printf("stored fork block %x at height %d", block.Hash, block.Height)
+
+	case err == nil:
+		n.Logger.Printf("added block %x at height %d", block.Hash, block.Height)
+
+		// um bloco concorrente chegou, a mineração atual é descartada
+		n.stopMining()
+		n.broadcast(p, cmdInv, Inv{Type: invBlock, Items: [][]byte{block.Hash}})
+
+	case errors.Is(err, blockchain.ErrBlockExists):
+
+	case errors.Is(err, blockchain.ErrOrphanBlock):
+		// falta algum bloco anterior, pede a lista completa
+		return p.send(cmdGetBlocks, nil)
+
+	default:
+		// os proximos blocos da fila descendem deste e seriam recebidos como
+		// orfãos, pedindo a lista de novo, então o nó que enviou o bloco é desconectado
+		return fmt.Errorf("rejected block %x: %w", block.Hash, err)
+	}
+
+	if err := n.requestNextBlock(p); err != nil {
+		return err
+	}
+
+	n.mine()
+	return nil
+}
+
+func (n *Node) handleTx(p *peer, payload TxMessage) error {
+	tx := payload.Transaction
+	if tx == nil {
+		return fmt.Errorf("empty transaction message")
+	}
+
+	if err := (blockchain.Mempool{BlockChain: n.Chain}).Add(tx); err != nil {
+		n.Logger.Printf("rejected transaction %x: %v", tx.ID, err)
+		return nil
+	}
+
+	n.Logger.Printf("added transaction %x to the mempool", tx.ID)
+	n.broadcast(p, cmdInv, Inv{Type: invTx, Items: [][]byte{tx.ID}})
+	n.mine()
+	return nil
+}
+
+// inicia a mineração das transações pendentes caso o nó seja minerador
+func (n *Node) mine() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Miner == "" || n.mining != nil || n.closed || n.syncing() {
+		return
+	}
+
+	// transações travadas por locktime ou sequence não disparam a mineração
+	unlocked, err := (blockchain.Mempool{BlockChain: n.Chain}).UnlockedTransactions()
+	if err != nil {
+		n.Logger.Printf("mempool: %v", err)
+		return
+	}
+	if len(unlocked) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.mining = cancel
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		block, err := n.Chain.MinePending(ctx, n.Miner)
+		stopped := ctx.Err() != nil
+
+		n.mu.Lock()
+		n.mining = nil
+		n.mu.Unlock()
+		cancel()
+
+		if err != nil {
+			n.Logger.Printf("mining stopped: %v", err)
+
+			// um bloco concorrente interrompeu a mineração ou chegou antes do
+			// bloco minerado, as transações que sobraram no mempool são mineradas
+			// sobre o novo topo
+			if stopped || errors.Is(err, blockchain.ErrNotOnTip) {
+				n.mine()
+			}
+			return
+		}
+
+		n.Logger.Printf("mined block %x at height %d", block.Hash, block.Height)
+		n.broadcast(nil, cmdInv, Inv{Type: invBlock, Items: [][]byte{block.Hash}})
+		n.mine()
+	}()
+}
+
+func (n *Node) stopMining() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.mining != nil {
+		n.mining()
+	}
+}
@@ -0,0 +1,496 @@
+package network
+
+import (
+	"blockchain-tutorial/blockchain"
+	"blockchain-tutorial/wallet"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// todos os nós usam uma dificuldade baixa para minerar os blocos rapidamente
+func TestMain(m *testing.M) {
+	blockchain.InitialDifficulty = 8
+	os.Exit(m.Run())
+}
+
+func newTestWallet(t *testing.T) *wallet.Wallet {
+	w, err := wallet.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// cria uma blockchain com o genesis pago ao endereço informado
+func newTestChain(t *testing.T, dir, address string) *blockchain.BlockChain {
+	dbPath := blockchain.DBPath
+	blockchain.DBPath = dir
+	defer func() { blockchain.DBPath = dbPath }()
+
+	chain, err := blockchain.InitBlockChain(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func openTestChain(t *testing.T, dir string) *blockchain.BlockChain {
+	chain, err := blockchain.OpenBlockChain(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func mineBlocks(t *testing.T, chain *blockchain.BlockChain, miner string, count int) {
+	for i := 0; i < count; i++ {
+		if _, err := chain.MinePending(context.Background(), miner); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// inicia um nó em uma porta livre do localhost
+func startTestNode(t *testing.T, chain *blockchain.BlockChain) *Node {
+	node := NewNode("127.0.0.1:0", chain)
+	node.Logger = log.New(ioutil.Discard, "", 0)
+
+	if err := node.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	node.Address = node.listener.Addr().String()
+
+	return node
+}
+
+func stopTestNode(node *Node) {
+	node.Close()
+	node.Chain.Close()
+}
+
+// copia o banco de uma blockchain fechada
+func copyDir(t *testing.T, src, dst string) {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, path[len(src):])
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, content, info.Mode())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func connect(t *testing.T, from, to *Node) {
+	if err := from.Connect(to.Address); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// espera até que a condição seja verdadeira ou o prazo acabe
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(20 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func waitForTip(t *testing.T, node *Node, tip *blockchain.BlockChain) {
+	height, hash := tip.GetBestHeight(), tip.LastHash()
+	waitFor(t, "node "+node.Address+" to sync", func() bool {
+		return node.Chain.GetBestHeight() == height && bytes.Equal(node.Chain.LastHash(), hash)
+	})
+}
+
+func TestNodesSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	miner := string(newTestWallet(t).Address())
+
+	source := newTestChain(t, filepath.Join(dir, "source"), miner)
+	mineBlocks(t, source, miner, 5)
+	seed := startTestNode(t, source)
+	defer stopTestNode(seed)
+
+	var nodes []*Node
+	for _, name := range []string{"a", "b", "c"} {
+		node := startTestNode(t, openTestChain(t, filepath.Join(dir, name)))
+		defer stopTestNode(node)
+		connect(t, node, seed)
+		nodes = append(nodes, node)
+	}
+
+	for _, node := range nodes {
+		waitForTip(t, node, source)
+	}
+
+	// um novo bloco do seed chega aos nós ja sincronizados
+	mineBlocks(t, source, miner, 1)
+	seed.broadcast(nil, cmdInv, Inv{Type: invBlock, Items: [][]byte{source.LastHash()}})
+
+	for _, node := range nodes {
+		waitForTip(t, node, source)
+	}
+}
+
+// o inv de um nó com menos blocos não pode descartar os
+// blocos que ainda seriam pedidos a outro nó
+func TestSyncFromSeveralPeers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	miner := string(newTestWallet(t).Address())
+
+	longPath := filepath.Join(dir, "long")
+
+	long := newTestChain(t, longPath, miner)
+	mineBlocks(t, long, miner, 5)
+	if err := long.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// os nós curtos tem apenas os primeiros blocos do nó longo
+	var shortPaths []string
+	for _, name := range []string{"short1", "short2"} {
+		shortPaths = append(shortPaths, filepath.Join(dir, name))
+		copyDir(t, longPath, filepath.Join(dir, name))
+	}
+
+	long = openTestChain(t, longPath)
+	mineBlocks(t, long, miner, 30)
+
+	longNode := startTestNode(t, long)
+	defer stopTestNode(longNode)
+
+	node := startTestNode(t, openTestChain(t, filepath.Join(dir, "node")))
+	defer stopTestNode(node)
+	connect(t, node, longNode)
+
+	var shortNodes []*Node
+	for _, path := range shortPaths {
+		shortNode := startTestNode(t, openTestChain(t, path))
+		defer stopTestNode(shortNode)
+		connect(t, node, shortNode)
+		shortNodes = append(shortNodes, shortNode)
+	}
+
+	waitForTip(t, node, long)
+	for _, shortNode := range shortNodes {
+		waitForTip(t, shortNode, long)
+	}
+}
+
+func TestRelayAndMineTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sender, receiver := newTestWallet(t), newTestWallet(t)
+	from, to := string(sender.Address()), string(receiver.Address())
+
+	chain := newTestChain(t, filepath.Join(dir, "sender"), from)
+	senderNode := startTestNode(t, chain)
+	defer stopTestNode(senderNode)
+
+	minerNode := startTestNode(t, openTestChain(t, filepath.Join(dir, "miner")))
+	defer stopTestNode(minerNode)
+	minerNode.Miner = string(newTestWallet(t).Address())
+	connect(t, minerNode, senderNode)
+	waitForTip(t, minerNode, chain)
+
+	ptx, err := blockchain.NewPartialTransaction(from, to, 10, 1, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.Sign(sender.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := senderNode.SendTransaction(&ptx.Transaction); err != nil {
+		t.Fatal(err)
+	}
+
+	// o bloco minerado pelo outro nó volta com a transação confirmada
+	waitFor(t, "the transaction to be mined", func() bool {
+		return chain.GetBestHeight() == 1
+	})
+	waitForTip(t, minerNode, chain)
+
+	outputs, err := blockchain.UTXOSet{BlockChain: chain}.FindUTXO(wallet.PublicKeyHash(receiver.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Value != 10 {
+		t.Fatalf("receiver outputs %v, want a single output of 10", outputs)
+	}
+}
+
+// um bloco concorrente interrompe a mineração, as transações que não
+// estavam nele devem ser mineradas sobre o novo topo
+func TestMiningRestartsAfterCompetingBlock(t *testing.T) {
+	// com uma dificuldade maior o bloco não é encontrado antes do primeiro OnHashrate
+	difficulty := blockchain.InitialDifficulty
+	blockchain.InitialDifficulty = 18
+	defer func() { blockchain.InitialDifficulty = difficulty }()
+
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	owner := newTestWallet(t)
+	from := string(owner.Address())
+
+	chain := newTestChain(t, filepath.Join(dir, "peer"), from)
+	peerNode := startTestNode(t, chain)
+	defer stopTestNode(peerNode)
+
+	minerNode := startTestNode(t, openTestChain(t, filepath.Join(dir, "miner")))
+	defer stopTestNode(minerNode)
+	minerNode.Miner = string(newTestWallet(t).Address())
+
+	// a mineração fica parada no primeiro OnHashrate até o bloco concorrente chegar
+	started, release := make(chan struct{}), make(chan struct{})
+	var once, releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	defer unblock()
+
+	minerNode.Chain.Mining = blockchain.MiningOptions{
+		Workers:        1,
+		ReportInterval: time.Microsecond,
+		OnHashrate: func(float64) {
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+		},
+	}
+
+	connect(t, minerNode, peerNode)
+	waitForTip(t, minerNode, chain)
+
+	ptx, err := blockchain.NewPartialTransaction(from, string(newTestWallet(t).Address()), 10, 1, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ptx.Sign(owner.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	tx := &ptx.Transaction
+
+	// o outro nó minera um bloco sem a transação
+	competing, err := chain.MinePending(context.Background(), from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := minerNode.SendTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(20 * time.Second):
+		t.Fatal("mining did not start")
+	}
+
+	peerNode.broadcast(nil, cmdInv, Inv{Type: invBlock, Items: [][]byte{competing.Hash}})
+	waitForTip(t, minerNode, chain)
+	unblock()
+
+	waitFor(t, "the transaction to be mined after the competing block", func() bool {
+		_, err := minerNode.Chain.FindTransaction(tx.ID)
+		return err == nil
+	})
+
+	block, err := minerNode.Chain.FindBlockByTransaction(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.PrevHash, competing.Hash) {
+		t.Fatalf("transaction mined on %x, want it on top of the competing block %x", block.PrevHash, competing.Hash)
+	}
+}
+
+// testPeer fala o protocolo diretamente pela conexão, assim
+// pode enviar blocos que um nó de verdade não aceitaria
+type testPeer struct {
+	conn    net.Conn
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+func dialTestPeer(t *testing.T, node *Node) *testPeer {
+	conn, err := net.Dial("tcp", node.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(20 * time.Second))
+
+	return &testPeer{conn, gob.NewEncoder(conn), gob.NewDecoder(conn)}
+}
+
+func (tp *testPeer) send(t *testing.T, command string, payload interface{}) {
+	message, err := newMessage(command, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.encoder.Encode(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lê as mensagens até receber o comando informado
+func (tp *testPeer) expect(t *testing.T, command string) Message {
+	for {
+		var msg Message
+		if err := tp.decoder.Decode(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", command, err)
+		}
+		if msg.Command == command {
+			return msg
+		}
+	}
+}
+
+// um bloco que estende o topo mas tem uma transação invalida não pode fazer o nó
+// pedir a lista de blocos de novo a cada filho dele, nem deixar a mineração parada
+func TestPeerDroppedAfterInvalidBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	owner := newTestWallet(t)
+	from, to := string(owner.Address()), string(newTestWallet(t).Address())
+
+	chain := newTestChain(t, filepath.Join(dir, "node"), from)
+	node := startTestNode(t, chain)
+	defer stopTestNode(node)
+	node.Miner = to
+
+	genesis, err := chain.GetBlock(chain.LastHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTx := func(amount int) *blockchain.Transaction {
+		ptx, err := blockchain.NewPartialTransaction(from, to, amount, 1, chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ptx.Sign(owner.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		return &ptx.Transaction
+	}
+
+	createBlock := func(parent *blockchain.Block, txs ...*blockchain.Transaction) *blockchain.Block {
+		coinbaseTx, err := blockchain.CoinbaseTx(to, "", blockchain.Subsidy(parent.Height+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := blockchain.CreateBlock(context.Background(), append([]*blockchain.Transaction{coinbaseTx}, txs...),
+			parent.Hash, parent.Height+1, parent.Timestamp+1, parent.Bits, blockchain.DefaultMiningOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+
+	// a assinatura alterada não muda o ID nem a prova de trabalho
+	invalidTx := newTx(10)
+	in := &invalidTx.Inputs[0]
+	in.Script = append([]byte{}, in.Script...)
+	in.Script[len(in.Script)-1] ^= 0x01
+
+	invalid := createBlock(genesis, invalidTx)
+	child := createBlock(invalid)
+
+	peer := dialTestPeer(t, node)
+	defer peer.conn.Close()
+
+	peer.send(t, cmdVersion, Version{Version: ProtocolVersion, Network: Network, BestHeight: child.Height, AddrFrom: "test"})
+	peer.expect(t, cmdGetBlocks)
+	peer.send(t, cmdInv, Inv{Type: invBlock, Items: [][]byte{child.Hash, invalid.Hash}})
+	peer.expect(t, cmdGetData)
+
+	// enquanto o bloco não chega o nó esta sincronizando e não minera
+	tx := newTx(20)
+	if err := node.SendTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	peer.send(t, cmdBlock, BlockMessage{Block: invalid})
+
+	for {
+		var msg Message
+		err := peer.decoder.Decode(&msg)
+		if err != nil {
+			break
+		}
+		if msg.Command == cmdGetData || msg.Command == cmdGetBlocks {
+			t.Fatalf("node sent %s after rejecting the block", msg.Command)
+		}
+	}
+
+	waitFor(t, "the node to drop the peer", func() bool {
+		return len(node.Peers()) == 0
+	})
+	waitFor(t, "the pending transaction to be mined", func() bool {
+		_, err := chain.FindTransaction(tx.ID)
+		return err == nil
+	})
+}
+
+func TestPeerQueueBlocks(t *testing.T) {
+	a, b := &peer{}, &peer{}
+
+	a.queueBlocks([][]byte{[]byte("1"), []byte("2")})
+	b.queueBlocks([][]byte{[]byte("1")})
+	a.queueBlocks([][]byte{[]byte("2"), []byte("3")})
+
+	for _, want := range []string{"1", "2", "3"} {
+		if got := a.nextBlock(); string(got) != want {
+			t.Fatalf("next block %q, want %q", got, want)
+		}
+	}
+	if a.syncing() || a.nextBlock() != nil {
+		t.Fatal("queue should be empty")
+	}
+
+	if !b.syncing() || string(b.nextBlock()) != "1" {
+		t.Fatal("blocks queued for another peer were lost")
+	}
+}
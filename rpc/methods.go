@@ -0,0 +1,446 @@
+package rpc
+
+import (
+	"blockchain-tutorial/blockchain"
+	"blockchain-tutorial/script"
+	"blockchain-tutorial/wallet"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var methods = map[string]handler{
+	"getblockcount":  getBlockCount,
+	"getblock":       getBlock,
+	"gettransaction": getTransaction,
+	"getbalance":     getBalance,
+	"sendtoaddress":  sendToAddress,
+	"createwallet":   createWallet,
+	"listaddresses":  listAddresses,
+}
+
+// params são os argumentos posicionais de uma chamada
+type params []json.RawMessage
+
+func (p params) max(count int) error {
+	if len(p) > count {
+		return newError(CodeInvalidParams, "expected at most %d params, got %d", count, len(p))
+	}
+	return nil
+}
+
+func (p params) string(index int, name string) (string, error) {
+	var value string
+	if index >= len(p) {
+		return "", newError(CodeInvalidParams, "missing param %q", name)
+	}
+	if err := json.Unmarshal(p[index], &value); err != nil {
+		return "", newError(CodeInvalidParams, "param %q must be a string", name)
+	}
+	return value, nil
+}
+
+// retorna fallback quando o parametro não foi informado
+func (p params) int(index int, name string, fallback int) (int, error) {
+	var value int
+	if index >= len(p) {
+		return fallback, nil
+	}
+	if err := json.Unmarshal(p[index], &value); err != nil {
+		return 0, newError(CodeInvalidParams, "param %q must be an integer", name)
+	}
+	return value, nil
+}
+
+func (p params) address(index int, name string) ([]byte, error) {
+	address, err := p.string(index, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := wallet.PublicKeyHashFromAddress(address)
+	if err != nil {
+		return nil, newError(CodeInvalidAddress, "invalid address %q", address)
+	}
+	return pubKeyHash, nil
+}
+
+func (p params) hash(index int, name string) ([]byte, error) {
+	value, err := p.string(index, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hex.DecodeString(value)
+	if err != nil || len(hash) == 0 {
+		return nil, newError(CodeInvalidParams, "param %q must be a hex encoded hash", name)
+	}
+	return hash, nil
+}
+
+type BlockResult struct {
+	Hash          string   `json:"hash"`
+	Confirmations int      `json:"confirmations"`
+	Version       int      `json:"version"`
+	Height        int      `json:"height"`
+	Timestamp     int64    `json:"time"`
+	PrevHash      string   `json:"previousblockhash,omitempty"`
+	MerkleRoot    string   `json:"merkleroot"`
+	Bits          string   `json:"bits"`
+	Nonce         int      `json:"nonce"`
+	Transactions  []string `json:"tx"`
+}
+
+// ScriptResult é o script desmontado e em hex
+type ScriptResult struct {
+	Asm string `json:"asm"`
+	Hex string `json:"hex"`
+}
+
+type InputResult struct {
+	TxID      string        `json:"txid,omitempty"`
+	Out       int           `json:"vout"`
+	Coinbase  string        `json:"coinbase,omitempty"`
+	ScriptSig *ScriptResult `json:"scriptsig,omitempty"`
+	Sequence  uint32        `json:"sequence"`
+}
+
+type OutputResult struct {
+	Value         int          `json:"value"`
+	PublicKeyHash string       `json:"publickeyhash,omitempty"`
+	Address       string       `json:"address,omitempty"`
+	ScriptPubKey  ScriptResult `json:"scriptpubkey"`
+}
+
+type TransactionResult struct {
+	TxID          string         `json:"txid"`
+	Version       int            `json:"version"`
+	Coinbase      bool           `json:"coinbase"`
+	Inputs        []InputResult  `json:"vin"`
+	Outputs       []OutputResult `json:"vout"`
+	LockTime      uint32         `json:"locktime"`
+	BlockHash     string         `json:"blockhash,omitempty"`
+	Confirmations int            `json:"confirmations"`
+}
+
+// AddressResult é um endereço do arquivo de carteiras, com as
+// mesmas informações que o listaddresses da linha de comando
+type AddressResult struct {
+	Address   string `json:"address"`
+	Label     string `json:"label"`
+	WatchOnly bool   `json:"watchonly"`
+	Multisig  string `json:"multisig,omitempty"`
+}
+
+// converte o bloco para o formato retornado pela API,
+// blocos de ramos paralelos não possuem confirmações
+func NewBlockResult(chain *blockchain.BlockChain, block *blockchain.Block) BlockResult {
+	result := BlockResult{
+		Hash:          hex.EncodeToString(block.Hash),
+		Confirmations: -1,
+		Version:       block.Version,
+		Height:        block.Height,
+		Timestamp:     block.Timestamp,
+		PrevHash:      hex.EncodeToString(block.PrevHash),
+		MerkleRoot:    hex.EncodeToString(block.MerkleRoot),
+		Bits:          fmt.Sprintf("%08x", block.Bits),
+		Nonce:         block.Nonce,
+		Transactions:  []string{},
+	}
+
+	for _, tx := range block.Transactions {
+		result.Transactions = append(result.Transactions, hex.EncodeToString(tx.ID))
+	}
+
+	if mainHash, err := chain.GetBlockHash(block.Height); err == nil && bytes.Equal(mainHash, block.Hash) {
+		result.Confirmations = chain.GetBestHeight() - block.Height + 1
+	}
+
+	return result
+}
+
+func NewScriptResult(data []byte) ScriptResult {
+	return ScriptResult{Asm: script.Disassemble(data), Hex: hex.EncodeToString(data)}
+}
+
+func NewTransactionResult(tx *blockchain.Transaction) TransactionResult {
+	result := TransactionResult{
+		TxID:     hex.EncodeToString(tx.ID),
+		Version:  tx.Version,
+		Coinbase: tx.IsCoinbase(),
+		Inputs:   []InputResult{},
+		Outputs:  []OutputResult{},
+		LockTime: tx.LockTime,
+	}
+
+	for _, in := range tx.Inputs {
+		input := InputResult{
+			TxID:     hex.EncodeToString(in.ID),
+			Out:      in.Out,
+			Sequence: in.Sequence,
+		}
+		if tx.IsCoinbase() {
+			input.Coinbase = hex.EncodeToString(in.PublicKey)
+		} else {
+			scriptSig := NewScriptResult(in.UnlockingScript())
+			input.ScriptSig = &scriptSig
+		}
+		result.Inputs = append(result.Inputs, input)
+	}
+
+	for _, out := range tx.Outputs {
+		result.Outputs = append(result.Outputs, OutputResult{
+			Value:         out.Value,
+			PublicKeyHash: hex.EncodeToString(out.AddressHash()),
+			Address:       out.Address(),
+			ScriptPubKey:  NewScriptResult(out.LockingScript()),
+		})
+	}
+
+	return result
+}
+
+// retorna a altura do ultimo bloco
+func getBlockCount(s *Server, p params) (interface{}, error) {
+	if err := p.max(0); err != nil {
+		return nil, err
+	}
+
+	return s.Chain.GetBestHeight(), nil
+}
+
+// getblock "hash" ou getblock height
+func getBlock(s *Server, p params) (interface{}, error) {
+	if err := p.max(1); err != nil {
+		return nil, err
+	}
+
+	if len(p) == 0 {
+		return nil, newError(CodeInvalidParams, "missing param %q", "hash")
+	}
+
+	var hash []byte
+	var height int
+	var err error
+
+	if json.Unmarshal(p[0], &height) == nil {
+		hash, err = s.Chain.GetBlockHash(height)
+		if err != nil {
+			return nil, newError(CodeNotFound, "block at height %d not found", height)
+		}
+	} else if hash, err = p.hash(0, "hash"); err != nil {
+		return nil, err
+	}
+
+	block, err := s.Chain.GetBlock(hash)
+	if err != nil {
+		return nil, newError(CodeNotFound, "block %x not found", hash)
+	}
+
+	return NewBlockResult(s.Chain, block), nil
+}
+
+// procura a transação no mempool e depois na blockchain
+func getTransaction(s *Server, p params) (interface{}, error) {
+	if err := p.max(1); err != nil {
+		return nil, err
+	}
+
+	txID, err := p.hash(0, "txid")
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := (blockchain.Mempool{BlockChain: s.Chain}).FindTransaction(txID)
+	if err == nil {
+		return NewTransactionResult(tx), nil
+	}
+	if !errors.Is(err, blockchain.ErrTxNotFound) {
+		return nil, err
+	}
+
+	block, err := s.Chain.FindBlockByTransaction(txID)
+	if errors.Is(err, blockchain.ErrTxNotFound) {
+		return nil, newError(CodeNotFound, "transaction %x not found", txID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range block.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			result := NewTransactionResult(tx)
+			result.BlockHash = hex.EncodeToString(block.Hash)
+			result.Confirmations = s.Chain.GetBestHeight() - block.Height + 1
+			return result, nil
+		}
+	}
+
+	return nil, newError(CodeNotFound, "transaction %x not found", txID)
+}
+
+func getBalance(s *Server, p params) (interface{}, error) {
+	if err := p.max(1); err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := p.address(0, "address")
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOs, err := (blockchain.UTXOSet{BlockChain: s.Chain}).FindUTXO(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	return balance, nil
+}
+
+// sendtoaddress "from" "to" amount [fee], adiciona a transação
+// ao mempool e retorna o seu ID
+func sendToAddress(s *Server, p params) (interface{}, error) {
+	if err := p.max(4); err != nil {
+		return nil, err
+	}
+
+	from, err := p.string(0, "from")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.address(0, "from"); err != nil {
+		return nil, err
+	}
+
+	to, err := p.string(1, "to")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.address(1, "to"); err != nil {
+		return nil, err
+	}
+
+	if len(p) < 3 {
+		return nil, newError(CodeInvalidParams, "missing param %q", "amount")
+	}
+	amount, err := p.int(2, "amount", 0)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := p.int(3, "fee", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := blockchain.CheckAmount(amount, fee); err != nil {
+		return nil, newError(CodeInvalidParams, "%v", err)
+	}
+
+	s.wallets.Lock()
+	tx, err := blockchain.NewTransaction(from, to, amount, fee, 0, 0, s.Chain)
+	s.wallets.Unlock()
+	if errors.Is(err, wallet.ErrWalletNotFound) {
+		return nil, newError(CodeWalletError, "address %s is not in the wallet", from)
+	}
+	if errors.Is(err, wallet.ErrWatchOnly) {
+		return nil, newError(CodeWalletError, "address %s is watch-only", from)
+	}
+	if errors.Is(err, blockchain.ErrInsufficientFunds) {
+		return nil, newError(CodeInsufficientFunds, "%v", err)
+	}
+	if rpcErr := passphraseError(err); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := (blockchain.Mempool{BlockChain: s.Chain}).Add(tx); err != nil {
+		var txErr *blockchain.TxError
+		if errors.As(err, &txErr) {
+			return nil, newError(CodeVerifyRejected, "%v", err)
+		}
+		return nil, err
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// cria uma nova carteira e retorna o seu endereço
+func createWallet(s *Server, p params) (interface{}, error) {
+	if err := p.max(0); err != nil {
+		return nil, err
+	}
+
+	s.wallets.Lock()
+	defer s.wallets.Unlock()
+
+	wallets, err := wallet.LoadWallets()
+	if rpcErr := passphraseError(err); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if err != nil {
+		return nil, newError(CodeWalletError, "could not load wallets: %v", err)
+	}
+
+	address, err := wallets.AddWallet()
+	if err != nil {
+		return nil, newError(CodeWalletError, "could not create wallet: %v", err)
+	}
+
+	if err := wallets.SaveFile(); err != nil {
+		return nil, newError(CodeWalletError, "could not save wallets: %v", err)
+	}
+
+	return address, nil
+}
+
+func listAddresses(s *Server, p params) (interface{}, error) {
+	if err := p.max(0); err != nil {
+		return nil, err
+	}
+
+	s.wallets.Lock()
+	defer s.wallets.Unlock()
+
+	wallets, err := wallet.LoadWallets()
+	if rpcErr := passphraseError(err); rpcErr != nil {
+		return nil, rpcErr
+	}
+	if err != nil {
+		return nil, newError(CodeWalletError, "could not load wallets: %v", err)
+	}
+
+	addresses := []AddressResult{}
+	for _, address := range wallets.GetAllAddresses() {
+		result := AddressResult{
+			Address:   address,
+			Label:     wallets.Label(address),
+			WatchOnly: wallets.IsWatchOnly(address),
+		}
+		if multisig, err := wallets.GetMultisig(address); err == nil {
+			result.Multisig = fmt.Sprintf("%d-of-%d", multisig.M, len(multisig.PublicKeys))
+		}
+		addresses = append(addresses, result)
+	}
+
+	return addresses, nil
+}
+
+// mapeia os erros do arquivo de carteiras criptografado para os códigos do bitcoind
+func passphraseError(err error) error {
+	if errors.Is(err, wallet.ErrPassphraseRequired) {
+		return newError(CodeUnlockNeeded, "%v", err)
+	}
+	if errors.Is(err, wallet.ErrWrongPassphrase) {
+		return newError(CodeWrongPassphrase, "%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package rpc
+
+import (
+	"blockchain-tutorial/blockchain"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	// códigos definidos pela especificação do JSON-RPC 2.0
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// códigos da aplicação, os mesmos usados pelo bitcoind
+	CodeWalletError       = -4
+	CodeInvalidAddress    = -5
+	CodeNotFound          = -5
+	CodeInsufficientFunds = -6
+	CodeUnlockNeeded      = -13
+	CodeWrongPassphrase   = -14
+	CodeVerifyRejected    = -26
+
+	// tamanho maximo do corpo de uma requisição
+	maxRequestSize = 1 << 20
+)
+
+// Error é o objeto de erro de uma resposta JSON-RPC
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func newError(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	// ausente nas notificações, que não recebem resposta
+	ID json.RawMessage `json:"id"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type handler func(s *Server, params params) (interface{}, error)
+
+// Server atende as chamadas JSON-RPC 2.0 por HTTP POST,
+// protegido por usuario e senha com basic auth
+type Server struct {
+	Chain    *blockchain.BlockChain
+	User     string
+	Password string
+	Logger   *log.Logger
+
+	// o arquivo de carteiras é lido e gravado por inteiro a cada alteração
+	wallets sync.Mutex
+}
+
+func NewServer(chain *blockchain.BlockChain, user, password string) *Server {
+	return &Server{
+		Chain:    chain,
+		User:     user,
+		Password: password,
+		Logger:   log.New(os.Stdout, "[rpc] ", log.LstdFlags),
+	}
+}
+
+func (s *Server) ListenAndServe(address string) error {
+	s.Logger.Printf("listening on %s", address)
+	return http.ListenAndServe(address, s)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	validUser := subtle.ConstantTimeCompare([]byte(user), []byte(s.User)) == 1
+	validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(s.Password)) == 1
+
+	return validUser && validPassword
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var reply interface{}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		reply = s.handleBatch(body)
+	} else {
+		reply = s.handleSingle(body)
+	}
+
+	// somente notificações, nada a responder
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		s.Logger.Printf("write response: %v", err)
+	}
+}
+
+func (s *Server) handleSingle(body []byte) interface{} {
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return response{JSONRPC: "2.0", Error: newError(CodeParseError, "parse error: %v", err)}
+	}
+
+	if res := s.process(req); res != nil {
+		return res
+	}
+	return nil
+}
+
+// processa uma lista de chamadas, respondendo na mesma ordem
+func (s *Server) handleBatch(body []byte) interface{} {
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return response{JSONRPC: "2.0", Error: newError(CodeParseError, "parse error: %v", err)}
+	}
+
+	if len(batch) == 0 {
+		return response{JSONRPC: "2.0", Error: newError(CodeInvalidRequest, "empty batch")}
+	}
+
+	var responses []*response
+
+	for _, raw := range batch {
+		var req request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			responses = append(responses, &response{JSONRPC: "2.0", Error: newError(CodeInvalidRequest, "invalid request")})
+			continue
+		}
+
+		if res := s.process(req); res != nil {
+			responses = append(responses, res)
+		}
+	}
+
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+// executa a chamada, retornando nil para as notificações
+func (s *Server) process(req request) *response {
+	res := &response{JSONRPC: "2.0", ID: req.ID}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		res.Error = newError(CodeInvalidRequest, "invalid request")
+		return res
+	}
+
+	result, err := s.call(req)
+
+	if req.ID == nil {
+		return nil
+	}
+
+	if err == nil {
+		res.Result, err = json.Marshal(result)
+	}
+
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = newError(CodeInternalError, "%v", err)
+		}
+		res.Result, res.Error = nil, rpcErr
+	}
+
+	return res
+}
+
+// chama o metodo convertendo em erro os panics das funções da blockchain
+func (s *Server) call(req request) (result interface{}, err error) {
+	method, ok := methods[req.Method]
+	if !ok {
+		return nil, newError(CodeMethodNotFound, "method %q not found", req.Method)
+	}
+
+	var args params
+	if len(req.Params) > 0 && !bytes.Equal(req.Params, []byte("null")) {
+		if err := json.Unmarshal(req.Params, &args); err != nil {
+			return nil, newError(CodeInvalidParams, "params must be an array")
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.Logger.Printf("%s: %v", req.Method, r)
+			result, err = nil, newError(CodeInternalError, "%v", r)
+		}
+	}()
+
+	return method(s, args)
+}
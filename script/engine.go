@@ -0,0 +1,283 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrScriptFailed   = errors.New("script failed")
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrNotPushOnly    = errors.New("unlocking script is not push only")
+	ErrReturn         = errors.New("script contains OP_RETURN")
+	ErrUnknownOpcode  = errors.New("unknown opcode")
+)
+
+// Checker valida o que depende da transação que gasta o output,
+// a assinatura do input, o locktime e o sequence
+type Checker interface {
+	CheckSignature(signature, publicKey []byte) bool
+	CheckLockTime(lockTime int64) bool
+	CheckSequence(sequence int64) bool
+}
+
+type stack [][]byte
+
+func (s *stack) push(data []byte) error {
+	if len(*s) >= MaxStackSize {
+		return fmt.Errorf("%w: stack has more than %d elements", ErrScriptFailed, MaxStackSize)
+	}
+	*s = append(*s, data)
+	return nil
+}
+
+func (s *stack) pop() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	data := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return data, nil
+}
+
+func (s *stack) peek() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	return (*s)[len(*s)-1], nil
+}
+
+// remove count elementos e os retorna na ordem em que foram empilhados
+func (s *stack) popN(count int) ([][]byte, error) {
+	if count < 0 || count > len(*s) {
+		return nil, ErrStackUnderflow
+	}
+	items := make([][]byte, count)
+	copy(items, (*s)[len(*s)-count:])
+	*s = (*s)[:len(*s)-count]
+	return items, nil
+}
+
+func (s *stack) popInt(maxSize int) (int64, error) {
+	data, err := s.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNumber(data, maxSize)
+}
+
+// executa o script de desbloqueio do input seguido do script de bloqueio do output,
+// o output é gasto quando a execução termina com um valor verdadeiro no topo da pilha.
+// Nos outputs PayToScriptHash o ultimo dado empilhado é o script que trava o output,
+// que também é executado com o restante da pilha
+func Execute(unlocking, locking []byte, checker Checker) error {
+	if !IsPushOnly(unlocking) {
+		return ErrNotPushOnly
+	}
+
+	var s stack
+	if err := run(&s, unlocking, checker); err != nil {
+		return err
+	}
+
+	initial := append(stack{}, s...)
+
+	if err := run(&s, locking, checker); err != nil {
+		return err
+	}
+	if err := checkResult(s); err != nil {
+		return err
+	}
+
+	if class, _ := Extract(locking); class != ScriptHash {
+		return nil
+	}
+
+	redeemScript, err := initial.pop()
+	if err != nil {
+		return err
+	}
+	if err := run(&initial, redeemScript, checker); err != nil {
+		return err
+	}
+	return checkResult(initial)
+}
+
+func checkResult(s stack) error {
+	top, err := s.peek()
+	if err != nil {
+		return fmt.Errorf("%w: empty stack at the end", ErrScriptFailed)
+	}
+	if !asBool(top) {
+		return fmt.Errorf("%w: false at the top of the stack", ErrScriptFailed)
+	}
+	return nil
+}
+
+func run(s *stack, script []byte, checker Checker) error {
+	instructions, err := parse(script)
+	if err != nil {
+		return err
+	}
+
+	for _, ins := range instructions {
+		if err := step(s, ins, checker); err != nil {
+			return fmt.Errorf("%s: %w", OpcodeName(ins.op), err)
+		}
+	}
+	return nil
+}
+
+func step(s *stack, ins instruction, checker Checker) error {
+	if isPush(ins.op) {
+		if len(ins.data) > MaxElementSize {
+			return fmt.Errorf("%w: element has more than %d bytes", ErrScriptFailed, MaxElementSize)
+		}
+		return s.push(pushValue(ins))
+	}
+
+	switch ins.op {
+	case OP_NOP:
+		return nil
+
+	case OP_RETURN:
+		return ErrReturn
+
+	case OP_VERIFY:
+		return verify(s)
+
+	case OP_DROP:
+		_, err := s.pop()
+		return err
+
+	case OP_DUP:
+		top, err := s.peek()
+		if err != nil {
+			return err
+		}
+		return s.push(top)
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		items, err := s.popN(2)
+		if err != nil {
+			return err
+		}
+		if err := s.push(fromBool(bytes.Equal(items[0], items[1]))); err != nil {
+			return err
+		}
+		if ins.op == OP_EQUALVERIFY {
+			return verify(s)
+		}
+		return nil
+
+	case OP_SHA256, OP_HASH160:
+		data, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if ins.op == OP_HASH160 {
+			return s.push(Hash160(data))
+		}
+		hash := sha256.Sum256(data)
+		return s.push(hash[:])
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		items, err := s.popN(2)
+		if err != nil {
+			return err
+		}
+		if err := s.push(fromBool(checker.CheckSignature(items[0], items[1]))); err != nil {
+			return err
+		}
+		if ins.op == OP_CHECKSIGVERIFY {
+			return verify(s)
+		}
+		return nil
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if err := checkMultisig(s, checker); err != nil {
+			return err
+		}
+		if ins.op == OP_CHECKMULTISIGVERIFY {
+			return verify(s)
+		}
+		return nil
+
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY:
+		// assim como no bitcoin o valor fica na pilha, seguido de um OP_DROP
+		top, err := s.peek()
+		if err != nil {
+			return err
+		}
+		lock, err := decodeNumber(top, maxLockTimeSize)
+		if err != nil {
+			return err
+		}
+		if lock < 0 {
+			return fmt.Errorf("%w: negative lock", ErrScriptFailed)
+		}
+		if ins.op == OP_CHECKLOCKTIMEVERIFY && !checker.CheckLockTime(lock) {
+			return fmt.Errorf("%w: locktime %d not reached", ErrScriptFailed, lock)
+		}
+		if ins.op == OP_CHECKSEQUENCEVERIFY && !checker.CheckSequence(lock) {
+			return fmt.Errorf("%w: sequence %#x not reached", ErrScriptFailed, lock)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: 0x%02x", ErrUnknownOpcode, ins.op)
+}
+
+func verify(s *stack) error {
+	top, err := s.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(top) {
+		return ErrScriptFailed
+	}
+	return nil
+}
+
+// <assinatura>... M <chave>... N, as assinaturas devem estar na mesma ordem
+// das chaves. Diferente do bitcoin, nenhum elemento extra é removido da pilha
+func checkMultisig(s *stack, checker Checker) error {
+	n, err := s.popInt(maxNumberSize)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > MaxMultisigKeys {
+		return fmt.Errorf("%w: %d keys", ErrScriptFailed, n)
+	}
+	publicKeys, err := s.popN(int(n))
+	if err != nil {
+		return err
+	}
+
+	m, err := s.popInt(maxNumberSize)
+	if err != nil {
+		return err
+	}
+	if m < 1 || m > n {
+		return fmt.Errorf("%w: %d signatures of %d keys", ErrScriptFailed, m, n)
+	}
+	signatures, err := s.popN(int(m))
+	if err != nil {
+		return err
+	}
+
+	key := 0
+	for _, signature := range signatures {
+		for key < len(publicKeys) && !checker.CheckSignature(signature, publicKeys[key]) {
+			key++
+		}
+		if key == len(publicKeys) {
+			return s.push(fromBool(false))
+		}
+		key++
+	}
+
+	return s.push(fromBool(true))
+}
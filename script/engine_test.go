@@ -0,0 +1,164 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// testChecker aceita a assinatura "sig:" + chave e compara os locks com
+// os valores da transação que gasta o output
+type testChecker struct {
+	lockTime int64
+	sequence int64
+}
+
+func (c testChecker) CheckSignature(signature, publicKey []byte) bool {
+	return bytes.Equal(signature, sign(publicKey))
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) CheckSequence(sequence int64) bool {
+	return sequence <= c.sequence
+}
+
+func sign(publicKey []byte) []byte {
+	return append([]byte("sig:"), publicKey...)
+}
+
+var (
+	key1 = []byte("public key 1")
+	key2 = []byte("public key 2")
+	key3 = []byte("public key 3")
+)
+
+func TestExecute(t *testing.T) {
+	p2pkh := PayToPubKeyHash(Hash160(key1))
+
+	redeemScript := MultisigScript(2, [][]byte{key1, key2, key3})
+	p2sh := PayToScriptHash(Hash160(redeemScript))
+	p2shUnlock := func(keys ...[]byte) []byte {
+		var signatures [][]byte
+		for _, key := range keys {
+			signatures = append(signatures, sign(key))
+		}
+		return ScriptHashSignatureScript(signatures, redeemScript)
+	}
+
+	otherRedeemScript := MultisigScript(2, [][]byte{key1, key2})
+	falseRedeemScript := NewBuilder().AddOp(OP_0).Script()
+
+	locked := func(op byte, lock int64) []byte {
+		return NewBuilder().AddInt(lock).AddOp(op).AddOp(OP_DROP).AddOp(OP_TRUE).Script()
+	}
+	checker := testChecker{lockTime: 500, sequence: 10}
+
+	sha := sha256.Sum256([]byte("data"))
+
+	tests := []struct {
+		name      string
+		unlocking []byte
+		locking   []byte
+		err       error
+	}{
+		// P2PKH
+		{"p2pkh", SignatureScript(sign(key1), key1), p2pkh, nil},
+		{"p2pkh wrong key", SignatureScript(sign(key2), key2), p2pkh, ErrScriptFailed},
+		{"p2pkh bad signature", SignatureScript(sign(key2), key1), p2pkh, ErrScriptFailed},
+		{"p2pkh empty unlock", nil, p2pkh, ErrStackUnderflow},
+		{"p2pkh unlock not push only", append(SignatureScript(sign(key1), key1), OP_DUP), p2pkh, ErrNotPushOnly},
+
+		// P2SH com multisig 2 de 3
+		{"p2sh keys 1 2", p2shUnlock(key1, key2), p2sh, nil},
+		{"p2sh keys 1 3", p2shUnlock(key1, key3), p2sh, nil},
+		{"p2sh keys 2 3", p2shUnlock(key2, key3), p2sh, nil},
+		{"p2sh wrong order", p2shUnlock(key2, key1), p2sh, ErrScriptFailed},
+		{"p2sh duplicate signature", p2shUnlock(key1, key1), p2sh, ErrScriptFailed},
+		{"p2sh fewer signatures", p2shUnlock(key1), p2sh, ErrStackUnderflow},
+		{"p2sh other redeem script", ScriptHashSignatureScript([][]byte{sign(key1), sign(key2)}, otherRedeemScript), p2sh, ErrScriptFailed},
+		{"p2sh false redeem script", NewBuilder().AddData(falseRedeemScript).Script(), PayToScriptHash(Hash160(falseRedeemScript)), ErrScriptFailed},
+
+		// multisig sem P2SH
+		{"bare multisig", NewBuilder().AddData(sign(key2)).Script(), MultisigScript(1, [][]byte{key1, key2}), nil},
+		{"bare multisig wrong key", NewBuilder().AddData(sign(key3)).Script(), MultisigScript(1, [][]byte{key1, key2}), ErrScriptFailed},
+
+		// OP_RETURN nunca pode ser gasto
+		{"null data", nil, NullDataScript([]byte("data")), ErrReturn},
+		{"null data with unlock", SignatureScript(sign(key1), key1), NullDataScript(nil), ErrReturn},
+
+		// locks
+		{"cltv reached", nil, locked(OP_CHECKLOCKTIMEVERIFY, 500), nil},
+		{"cltv not reached", nil, locked(OP_CHECKLOCKTIMEVERIFY, 501), ErrScriptFailed},
+		{"cltv negative", nil, locked(OP_CHECKLOCKTIMEVERIFY, -1), ErrScriptFailed},
+		{"cltv five bytes", nil, locked(OP_CHECKLOCKTIMEVERIFY, 1<<32), ErrScriptFailed},
+		{"csv reached", nil, locked(OP_CHECKSEQUENCEVERIFY, 10), nil},
+		{"csv not reached", nil, locked(OP_CHECKSEQUENCEVERIFY, 11), ErrScriptFailed},
+		{"cltv empty stack", nil, []byte{OP_CHECKLOCKTIMEVERIFY}, ErrStackUnderflow},
+		{"cltv non minimal number", nil, NewBuilder().AddData([]byte{0x05, 0x00}).AddOp(OP_CHECKLOCKTIMEVERIFY).Script(), ErrInvalidNumber},
+
+		// opcodes
+		{"true", nil, []byte{OP_TRUE}, nil},
+		{"false", nil, []byte{OP_FALSE}, ErrScriptFailed},
+		{"negative zero is false", NewBuilder().AddData([]byte{0x80}).Script(), nil, ErrScriptFailed},
+		{"empty scripts", nil, nil, ErrScriptFailed},
+		{"nop", []byte{OP_TRUE}, []byte{OP_NOP}, nil},
+		{"verify true", []byte{OP_TRUE}, []byte{OP_VERIFY, OP_TRUE}, nil},
+		{"verify false", []byte{OP_FALSE}, []byte{OP_VERIFY, OP_TRUE}, ErrScriptFailed},
+		{"drop", []byte{OP_TRUE, OP_FALSE}, []byte{OP_DROP}, nil},
+		{"drop empty stack", nil, []byte{OP_DROP}, ErrStackUnderflow},
+		{"equal", []byte{OP_1, OP_1}, []byte{OP_EQUAL}, nil},
+		{"not equal", NewBuilder().AddInt(1).AddInt(2).Script(), []byte{OP_EQUAL}, ErrScriptFailed},
+		{"equalverify", NewBuilder().AddInt(1).AddInt(2).Script(), []byte{OP_EQUALVERIFY, OP_TRUE}, ErrScriptFailed},
+		{"sha256", NewBuilder().AddData([]byte("data")).Script(), NewBuilder().AddOp(OP_SHA256).AddData(sha[:]).AddOp(OP_EQUAL).Script(), nil},
+		{"checksigverify", SignatureScript(sign(key1), key1), []byte{OP_CHECKSIGVERIFY, OP_TRUE}, nil},
+		{"checksigverify bad signature", SignatureScript(sign(key2), key1), []byte{OP_CHECKSIGVERIFY, OP_TRUE}, ErrScriptFailed},
+		{"unknown opcode", nil, []byte{0xff}, ErrUnknownOpcode},
+		{"truncated push", nil, []byte{0x05, 0x01}, ErrMalformedScript},
+		{"element too large", NewBuilder().AddData(make([]byte, MaxElementSize+1)).Script(), []byte{OP_DROP, OP_TRUE}, ErrScriptFailed},
+	}
+
+	for _, test := range tests {
+		err := Execute(test.unlocking, test.locking, checker)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestNumberEncoding(t *testing.T) {
+	tests := []struct {
+		n       int64
+		encoded []byte
+	}{
+		{0, nil},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{255, []byte{0xff, 0x00}},
+		{256, []byte{0x00, 0x01}},
+		{-256, []byte{0x00, 0x81}},
+	}
+
+	for _, test := range tests {
+		encoded := encodeNumber(test.n)
+		if !bytes.Equal(encoded, test.encoded) {
+			t.Errorf("encodeNumber(%d) = %x, want %x", test.n, encoded, test.encoded)
+		}
+		n, err := decodeNumber(test.encoded, maxNumberSize)
+		if err != nil || n != test.n {
+			t.Errorf("decodeNumber(%x) = %d, %v, want %d", test.encoded, n, err, test.n)
+		}
+	}
+
+	for _, data := range [][]byte{{0x00}, {0x80}, {0x01, 0x00}, {0x01, 0x80}, {1, 2, 3, 4, 5}} {
+		if _, err := decodeNumber(data, maxNumberSize); !errors.Is(err, ErrInvalidNumber) {
+			t.Errorf("decodeNumber(%x) returned %v, want %v", data, err, ErrInvalidNumber)
+		}
+	}
+}
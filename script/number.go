@@ -0,0 +1,91 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// tamanho maximo dos numeros usados nas operações, o locktime aceita 5 bytes
+	maxNumberSize   = 4
+	maxLockTimeSize = 5
+)
+
+var (
+	ErrInvalidNumber = errors.New("invalid script number")
+)
+
+// numeros são little endian com o bit mais alto do ultimo byte indicando o sinal
+func encodeNumber(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+
+	var result []byte
+	for n > 0 {
+		result = append(result, byte(n&0xff))
+		n >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// somente a codificação minima de cada numero é aceita, evitando
+// que o mesmo script possa ser escrito de mais de uma forma
+func decodeNumber(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, fmt.Errorf("%w: %d bytes, at most %d", ErrInvalidNumber, len(data), maxSize)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, fmt.Errorf("%w: %x is not minimally encoded", ErrInvalidNumber, data)
+	}
+
+	var n int64
+	for index, b := range data {
+		n |= int64(b) << uint(8*index)
+	}
+
+	if last&0x80 != 0 {
+		n &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		n = -n
+	}
+
+	return n, nil
+}
+
+// valor de verdade de um elemento da pilha, zero e zero negativo são falsos
+func asBool(data []byte) bool {
+	for index, b := range data {
+		if b != 0 {
+			return !(index == len(data)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+func fromBool(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package script
+
+import "fmt"
+
+// os opcodes usam os mesmos valores do bitcoin
+const (
+	OP_0         = 0x00
+	OP_FALSE     = OP_0
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_PUSHDATA4 = 0x4e
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51
+	OP_TRUE      = OP_1
+	OP_16        = 0x60
+
+	OP_NOP    = 0x61
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	OP_DROP = 0x75
+	OP_DUP  = 0x76
+
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+)
+
+var opcodeNames = map[byte]string{
+	OP_0:         "OP_0",
+	OP_PUSHDATA1: "OP_PUSHDATA1",
+	OP_PUSHDATA2: "OP_PUSHDATA2",
+	OP_PUSHDATA4: "OP_PUSHDATA4",
+	OP_1NEGATE:   "OP_1NEGATE",
+
+	OP_NOP:    "OP_NOP",
+	OP_VERIFY: "OP_VERIFY",
+	OP_RETURN: "OP_RETURN",
+
+	OP_DROP: "OP_DROP",
+	OP_DUP:  "OP_DUP",
+
+	OP_EQUAL:       "OP_EQUAL",
+	OP_EQUALVERIFY: "OP_EQUALVERIFY",
+
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// nome do opcode como aparece na desmontagem do script
+func OpcodeName(op byte) string {
+	if op >= OP_1 && op <= OP_16 {
+		return fmt.Sprintf("OP_%d", op-OP_1+1)
+	}
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN%d", op)
+}
+
+// opcodes que apenas empilham dados ou numeros pequenos
+func isPush(op byte) bool {
+	return op <= OP_PUSHDATA4 || op == OP_1NEGATE || (op >= OP_1 && op <= OP_16)
+}
@@ -0,0 +1,172 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// mesmos limites do bitcoin
+	MaxScriptSize  = 10000
+	MaxElementSize = 520
+	MaxStackSize   = 1000
+)
+
+var (
+	ErrMalformedScript = errors.New("malformed script")
+)
+
+// instruction é um opcode e os dados que ele empilha, se houver
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+// separa o script em instruções, falhando quando um push ultrapassa o fim do script
+func parse(script []byte) ([]instruction, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("%w: script has %d bytes", ErrMalformedScript, len(script))
+	}
+
+	var instructions []instruction
+
+	for offset := 0; offset < len(script); {
+		op := script[offset]
+		offset++
+
+		size := 0
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			size = int(op)
+		case op == OP_PUSHDATA1 || op == OP_PUSHDATA2 || op == OP_PUSHDATA4:
+			width := map[byte]int{OP_PUSHDATA1: 1, OP_PUSHDATA2: 2, OP_PUSHDATA4: 4}[op]
+			if offset+width > len(script) {
+				return nil, fmt.Errorf("%w: truncated %s", ErrMalformedScript, OpcodeName(op))
+			}
+			var length [4]byte
+			copy(length[:], script[offset:offset+width])
+			size = int(binary.LittleEndian.Uint32(length[:]))
+			offset += width
+		}
+
+		if size > len(script)-offset {
+			return nil, fmt.Errorf("%w: push of %d bytes past the end", ErrMalformedScript, size)
+		}
+
+		instructions = append(instructions, instruction{op: op, data: script[offset : offset+size]})
+		offset += size
+	}
+
+	return instructions, nil
+}
+
+// Builder monta scripts usando sempre o menor push possivel para os dados
+type Builder struct {
+	script []byte
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+	return b
+}
+
+func (b *Builder) AddData(data []byte) *Builder {
+	switch {
+	case len(data) == 0:
+		b.script = append(b.script, OP_0)
+	case len(data) < OP_PUSHDATA1:
+		b.script = append(b.script, byte(len(data)))
+	case len(data) <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(len(data)))
+	case len(data) <= 0xffff:
+		b.script = append(b.script, OP_PUSHDATA2, byte(len(data)), byte(len(data)>>8))
+	default:
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(data)))
+		b.script = append(append(b.script, OP_PUSHDATA4), length[:]...)
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// numeros de -1 a 16 usam os opcodes proprios, os demais são empilhados como dados
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(byte(OP_1 + n - 1))
+	}
+	return b.AddData(encodeNumber(n))
+}
+
+func (b *Builder) Script() []byte {
+	return b.script
+}
+
+// desmonta o script no formato do bitcoin, com os dados em hex
+func Disassemble(script []byte) string {
+	instructions, err := parse(script)
+	if err != nil {
+		return fmt.Sprintf("[%v]", err)
+	}
+
+	var parts []string
+	for _, ins := range instructions {
+		if ins.op > OP_0 && ins.op <= OP_PUSHDATA4 {
+			parts = append(parts, hex.EncodeToString(ins.data))
+		} else {
+			parts = append(parts, OpcodeName(ins.op))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// verdadeiro quando o script somente empilha dados, como devem ser os scripts de desbloqueio
+func IsPushOnly(script []byte) bool {
+	instructions, err := parse(script)
+	if err != nil {
+		return false
+	}
+	for _, ins := range instructions {
+		if !isPush(ins.op) {
+			return false
+		}
+	}
+	return true
+}
+
+// retorna os dados empilhados por um script que somente empilha dados
+func PushedData(script []byte) ([][]byte, error) {
+	if !IsPushOnly(script) {
+		return nil, fmt.Errorf("%w: script is not push only", ErrMalformedScript)
+	}
+
+	instructions, _ := parse(script)
+
+	var data [][]byte
+	for _, ins := range instructions {
+		data = append(data, pushValue(ins))
+	}
+	return data, nil
+}
+
+// valor empilhado por uma instrução de push
+func pushValue(ins instruction) []byte {
+	switch {
+	case ins.op == OP_1NEGATE:
+		return encodeNumber(-1)
+	case ins.op >= OP_1 && ins.op <= OP_16:
+		return encodeNumber(int64(ins.op - OP_1 + 1))
+	}
+	return ins.data
+}
@@ -0,0 +1,166 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	hashLength = 20
+
+	// mesmo limite de chaves do OP_CHECKMULTISIG em P2SH
+	MaxMultisigKeys = 15
+)
+
+// Class é o tipo de um script de bloqueio padrão
+type Class int
+
+const (
+	NonStandard Class = iota
+	PubKeyHash
+	ScriptHash
+	Multisig
+	NullData
+)
+
+func (c Class) String() string {
+	switch c {
+	case PubKeyHash:
+		return "pubkeyhash"
+	case ScriptHash:
+		return "scripthash"
+	case Multisig:
+		return "multisig"
+	case NullData:
+		return "nulldata"
+	}
+	return "nonstandard"
+}
+
+func Hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+
+	// o Write de um hash.Hash nunca retorna erro
+	hasher := ripemd160.New()
+	hasher.Write(hash[:])
+
+	return hasher.Sum(nil)
+}
+
+// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	return NewBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+}
+
+// OP_HASH160 <hash> OP_EQUAL, desbloqueado pelo script cujo hash é informado
+func PayToScriptHash(scriptHash []byte) []byte {
+	return NewBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// OP_M <chave>... OP_N OP_CHECKMULTISIG
+func MultisigScript(m int, publicKeys [][]byte) []byte {
+	builder := NewBuilder().AddInt(int64(m))
+	for _, publicKey := range publicKeys {
+		builder.AddData(publicKey)
+	}
+	return builder.AddInt(int64(len(publicKeys))).AddOp(OP_CHECKMULTISIG).Script()
+}
+
+// OP_RETURN <dados>, um output que nunca pode ser gasto
+func NullDataScript(data []byte) []byte {
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script()
+}
+
+// <assinatura> <chave publica>, desbloqueia o PayToPubKeyHash
+func SignatureScript(signature, publicKey []byte) []byte {
+	return NewBuilder().AddData(signature).AddData(publicKey).Script()
+}
+
+// <assinatura>... <script>, desbloqueia o PayToScriptHash de um multisig,
+// as assinaturas devem seguir a ordem das chaves no script
+func ScriptHashSignatureScript(signatures [][]byte, redeemScript []byte) []byte {
+	builder := NewBuilder()
+	for _, signature := range signatures {
+		builder.AddData(signature)
+	}
+	return builder.AddData(redeemScript).Script()
+}
+
+// identifica o tipo do script e retorna o hash que ele trava,
+// nos scripts PubKeyHash e ScriptHash
+func Extract(script []byte) (Class, []byte) {
+	instructions, err := parse(script)
+	if err != nil {
+		return NonStandard, nil
+	}
+
+	switch {
+	case len(instructions) == 5 &&
+		instructions[0].op == OP_DUP &&
+		instructions[1].op == OP_HASH160 &&
+		instructions[2].op == hashLength &&
+		instructions[3].op == OP_EQUALVERIFY &&
+		instructions[4].op == OP_CHECKSIG:
+		return PubKeyHash, instructions[2].data
+
+	case len(instructions) == 3 &&
+		instructions[0].op == OP_HASH160 &&
+		instructions[1].op == hashLength &&
+		instructions[2].op == OP_EQUAL:
+		return ScriptHash, instructions[1].data
+
+	case len(instructions) > 0 && instructions[0].op == OP_RETURN && IsPushOnly(script[1:]):
+		return NullData, nil
+	}
+
+	if _, _, err := ParseMultisig(script); err == nil {
+		return Multisig, nil
+	}
+
+	return NonStandard, nil
+}
+
+// retorna M e as chaves de um script multisig
+func ParseMultisig(script []byte) (int, [][]byte, error) {
+	instructions, err := parse(script)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	count := len(instructions)
+	if count < 4 || instructions[count-1].op != OP_CHECKMULTISIG {
+		return 0, nil, fmt.Errorf("%w: not a multisig script", ErrMalformedScript)
+	}
+
+	m, n := smallInt(instructions[0].op), smallInt(instructions[count-2].op)
+	if m < 1 || n < m || n != count-3 || n > MaxMultisigKeys {
+		return 0, nil, fmt.Errorf("%w: invalid multisig counts", ErrMalformedScript)
+	}
+
+	var publicKeys [][]byte
+	for _, ins := range instructions[1 : count-2] {
+		if ins.op == OP_0 || ins.op > OP_PUSHDATA4 {
+			return 0, nil, fmt.Errorf("%w: invalid multisig key", ErrMalformedScript)
+		}
+		publicKeys = append(publicKeys, ins.data)
+	}
+
+	// somente a forma que o Builder produz é aceita
+	if !bytes.Equal(script, MultisigScript(m, publicKeys)) {
+		return 0, nil, fmt.Errorf("%w: non canonical multisig script", ErrMalformedScript)
+	}
+
+	return m, publicKeys, nil
+}
+
+// valor de OP_1 a OP_16, ou -1 para os demais opcodes
+func smallInt(op byte) int {
+	if op >= OP_1 && op <= OP_16 {
+		return int(op - OP_1 + 1)
+	}
+	return -1
+}
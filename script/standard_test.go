@@ -0,0 +1,73 @@
+package script
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	hash := Hash160(key1)
+
+	tests := []struct {
+		name   string
+		script []byte
+		class  Class
+		hash   []byte
+	}{
+		{"p2pkh", PayToPubKeyHash(hash), PubKeyHash, hash},
+		{"p2sh", PayToScriptHash(hash), ScriptHash, hash},
+		{"multisig", MultisigScript(2, [][]byte{key1, key2, key3}), Multisig, nil},
+		{"null data", NullDataScript([]byte("data")), NullData, nil},
+		{"empty null data", []byte{OP_RETURN}, NullData, nil},
+
+		// os hashes devem ter exatamente 20 bytes
+		{"p2pkh short hash", PayToPubKeyHash(hash[:19]), NonStandard, nil},
+		{"p2pkh long hash", PayToPubKeyHash(append(hash, 0)), NonStandard, nil},
+		{"p2sh sha256 hash", PayToScriptHash(make([]byte, 32)), NonStandard, nil},
+
+		{"null data not push only", []byte{OP_RETURN, OP_DUP}, NonStandard, nil},
+		{"multisig m greater than n", MultisigScript(3, [][]byte{key1, key2}), NonStandard, nil},
+		{"multisig too many keys", MultisigScript(1, make([][]byte, MaxMultisigKeys+1)), NonStandard, nil},
+		{"multisig count pushed as data", NewBuilder().AddData([]byte{1}).AddData(key1).AddInt(1).AddOp(OP_CHECKMULTISIG).Script(), NonStandard, nil},
+		{"truncated", []byte{OP_DUP, OP_HASH160, 20, 1}, NonStandard, nil},
+		{"empty", nil, NonStandard, nil},
+	}
+
+	for _, test := range tests {
+		class, hash := Extract(test.script)
+		if class != test.class || !bytes.Equal(hash, test.hash) {
+			t.Errorf("%s: got %v %x, want %v %x", test.name, class, hash, test.class, test.hash)
+		}
+	}
+}
+
+func TestParseMultisig(t *testing.T) {
+	keys := [][]byte{key1, key2, key3}
+
+	m, publicKeys, err := ParseMultisig(MultisigScript(2, keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != 2 || len(publicKeys) != len(keys) {
+		t.Fatalf("got %d of %d keys, want 2 of %d", m, len(publicKeys), len(keys))
+	}
+	for index := range keys {
+		if !bytes.Equal(publicKeys[index], keys[index]) {
+			t.Errorf("key %d is %x, want %x", index, publicKeys[index], keys[index])
+		}
+	}
+}
+
+func TestPushedData(t *testing.T) {
+	data, err := PushedData(SignatureScript(sign(key1), key1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || !bytes.Equal(data[0], sign(key1)) || !bytes.Equal(data[1], key1) {
+		t.Fatalf("pushed data %x", data)
+	}
+
+	if _, err := PushedData(PayToPubKeyHash(Hash160(key1))); err == nil {
+		t.Fatal("a script with opcodes is not push only")
+	}
+}
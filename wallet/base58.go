@@ -1,7 +1,7 @@
 package wallet
 
 import (
-	"blockchain-tutorial/utils"
+	"fmt"
 
 	"github.com/mr-tron/base58"
 )
@@ -11,8 +11,10 @@ func Base58Encode(input []byte) []byte {
 	return []byte(encode)
 }
 
-func Base58Decode(input []byte) []byte {
+func Base58Decode(input []byte) ([]byte, error) {
 	decode, err := base58.Decode(string(input[:]))
-	utils.HandleError(err)
-	return decode
+	if err != nil {
+		return nil, fmt.Errorf("base58: %w", err)
+	}
+	return decode, nil
 }
@@ -0,0 +1,167 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// parametros do scrypt usados nos arquivos novos, cada arquivo guarda
+	// os seus para que possam ser aumentados sem quebrar os antigos
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// limites dos parametros lidos do arquivo, assim um arquivo alterado não
+	// faz o scrypt usar mais de 256 MiB ou 64 vezes o trabalho dos atuais
+	scryptMaxMemory = 256 << 20
+	scryptMaxWork   = 64 * scryptN * scryptR * scryptP
+
+	saltLength = 16
+	keyLength  = 32
+)
+
+var (
+	// inicio dos arquivos de carteiras criptografados
+	encryptedMagic = []byte("wallets-aes256gcm-scrypt\n")
+
+	ErrPassphraseRequired = errors.New("wallet file is encrypted, a passphrase is required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase")
+	ErrEmptyPassphrase    = errors.New("passphrase must not be empty")
+	ErrEncrypted          = errors.New("wallet file is already encrypted")
+	ErrNotEncrypted       = errors.New("wallet file is not encrypted")
+	ErrScryptParams       = errors.New("invalid scrypt parameters in the wallet file")
+
+	// chamada quando o arquivo de carteiras esta criptografado,
+	// a CLI lê a senha de uma variavel de ambiente ou do terminal
+	Passphrase func() ([]byte, error)
+)
+
+// encryptedFile é o conteudo do arquivo após encryptedMagic, o texto
+// cifrado é o WalletSet serializado com gob
+type encryptedFile struct {
+	Salt       []byte
+	N, R, P    int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+func isEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, encryptedMagic)
+}
+
+func newGCM(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// cifra o conteudo com uma chave derivada da senha e um salt novo
+func encrypt(plaintext, passphrase []byte) ([]byte, error) {
+	file := encryptedFile{Salt: make([]byte, saltLength), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, encryptedMagic)
+
+	var content bytes.Buffer
+	content.Write(encryptedMagic)
+	if err := gob.NewEncoder(&content).Encode(file); err != nil {
+		return nil, err
+	}
+
+	return content.Bytes(), nil
+}
+
+// o scrypt usa 128 * N * r bytes e o trabalho cresce com N * r * p
+func checkScryptParams(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 ||
+		n > scryptMaxMemory/128/r || p > scryptMaxWork/n/r {
+		return fmt.Errorf("%w: N=%d r=%d p=%d", ErrScryptParams, n, r, p)
+	}
+	return nil
+}
+
+// decifra o conteudo, o GCM garante que uma senha errada
+// ou um arquivo alterado não passem despercebidos
+func decrypt(content, passphrase []byte) ([]byte, error) {
+	var file encryptedFile
+
+	decoder := gob.NewDecoder(bytes.NewReader(content[len(encryptedMagic):]))
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("decode encrypted wallets: %w", err)
+	}
+
+	if err := checkScryptParams(file.N, file.R, file.P); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(file.Nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, encryptedMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+func (ws *WalletSet) IsEncrypted() bool {
+	return ws.passphrase != nil
+}
+
+// passa a gravar o arquivo criptografado com a senha informada
+func (ws *WalletSet) Encrypt(passphrase []byte) error {
+	if ws.IsEncrypted() {
+		return ErrEncrypted
+	}
+	if len(passphrase) == 0 {
+		return ErrEmptyPassphrase
+	}
+
+	ws.passphrase = passphrase
+	return nil
+}
+
+func (ws *WalletSet) ChangePassphrase(passphrase []byte) error {
+	if !ws.IsEncrypted() {
+		return ErrNotEncrypted
+	}
+	if len(passphrase) == 0 {
+		return ErrEmptyPassphrase
+	}
+
+	ws.passphrase = passphrase
+	return nil
+}
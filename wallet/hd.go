@@ -0,0 +1,178 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	secp256k1 "github.com/haltingstate/secp256k1-go"
+)
+
+const (
+	// indices a partir deste valor geram filhos hardened
+	HardenedOffset = uint32(0x80000000)
+
+	// quantidade de endereços seguidos sem uso que encerra a busca da restauração
+	DefaultGapLimit = 20
+
+	purposeBIP44 = 44
+)
+
+var (
+	// tipo de moeda do caminho BIP44, muda de acordo com a rede
+	CoinType = uint32(0)
+
+	ErrSeedExists   = errors.New("wallet already has a different seed")
+	ErrInvalidChild = errors.New("invalid child key")
+
+	// ordem da curva secp256k1
+	curveN, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+)
+
+// ExtendedKey é uma chave privada BIP32, o chain code permite derivar os filhos
+type ExtendedKey struct {
+	Key       []byte
+	ChainCode []byte
+	Depth     byte
+	Index     uint32
+}
+
+// chave mestre derivada da semente
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("invalid seed size %d", len(seed))
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if _, err := ParsePrivateKey(sum[:32], KeyCompressed); err != nil {
+		return nil, ErrInvalidChild
+	}
+
+	return &ExtendedKey{Key: sum[:32], ChainCode: sum[32:]}, nil
+}
+
+// deriva o filho com o indice informado, filhos hardened usam a chave
+// privada e os normais a chave publica do pai
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	var data bytes.Buffer
+	if index >= HardenedOffset {
+		data.WriteByte(0x00)
+		data.Write(k.Key)
+	} else {
+		data.Write(secp256k1.PubkeyFromSeckey(k.Key))
+	}
+	binary.Write(&data, binary.BigEndian, index)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data.Bytes())
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(curveN) >= 0 {
+		return nil, ErrInvalidChild
+	}
+
+	child := tweak.Add(tweak, new(big.Int).SetBytes(k.Key))
+	child.Mod(child, curveN)
+	if child.Sign() == 0 {
+		return nil, ErrInvalidChild
+	}
+
+	key := make([]byte, privateKeyLength)
+	raw := child.Bytes()
+	copy(key[privateKeyLength-len(raw):], raw)
+
+	return &ExtendedKey{Key: key, ChainCode: sum[32:], Depth: k.Depth + 1, Index: index}, nil
+}
+
+// deriva uma sequencia de filhos a partir desta chave
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		child, err := key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+	return key, nil
+}
+
+func (k *ExtendedKey) PrivateKey() PrivateKey {
+	return PrivateKey{Type: KeyCompressed, D: k.Key}
+}
+
+// formata o caminho no formato m/44'/0'/0'/0/0
+func FormatPath(path []uint32) string {
+	parts := []string{"m"}
+	for _, index := range path {
+		if index >= HardenedOffset {
+			parts = append(parts, fmt.Sprintf("%d'", index-HardenedOffset))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d", index))
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// HDWallet guarda a semente BIP39 e o proximo indice de endereço,
+// os endereços seguem o caminho BIP44 m/44'/coin'/account'/0/index
+type HDWallet struct {
+	Seed      []byte
+	CoinType  uint32
+	Account   uint32
+	NextIndex uint32
+}
+
+func NewHDWallet(seed []byte) *HDWallet {
+	return &HDWallet{Seed: seed, CoinType: CoinType}
+}
+
+func (hd *HDWallet) Path(index uint32) []uint32 {
+	return []uint32{
+		purposeBIP44 + HardenedOffset,
+		hd.CoinType + HardenedOffset,
+		hd.Account + HardenedOffset,
+		0,
+		index,
+	}
+}
+
+// deriva a carteira do endereço com o indice informado
+func (hd *HDWallet) Derive(index uint32) (*Wallet, error) {
+	master, err := NewMasterKey(hd.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	path := hd.Path(index)
+	key, err := master.Derive(path)
+	if err != nil {
+		return nil, fmt.Errorf("derive %s: %w", FormatPath(path), err)
+	}
+
+	privateKey := key.PrivateKey()
+	return &Wallet{PrivateKey: privateKey, PublicKey: privateKey.PublicKey(), Path: FormatPath(path)}, nil
+}
+
+// deriva a proxima carteira, pulando os raros indices invalidos
+func (hd *HDWallet) Next() (*Wallet, error) {
+	for {
+		index := hd.NextIndex
+		hd.NextIndex++
+
+		wallet, err := hd.Derive(index)
+		if errors.Is(err, ErrInvalidChild) {
+			continue
+		}
+		return wallet, err
+	}
+}
@@ -0,0 +1,99 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// vetor de teste 1 da BIP32, as chaves e chain codes são os dos xprv da especificação
+func TestBIP32Vector1(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{
+			nil,
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+		},
+		{
+			[]uint32{HardenedOffset},
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+		},
+		{
+			[]uint32{HardenedOffset, 1},
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+		},
+		{
+			[]uint32{HardenedOffset, 1, HardenedOffset + 2},
+			"04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f",
+			"cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+		},
+		{
+			[]uint32{HardenedOffset, 1, HardenedOffset + 2, 2},
+			"cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd",
+			"0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4",
+		},
+		{
+			[]uint32{HardenedOffset, 1, HardenedOffset + 2, 2, 1000000000},
+			"c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e",
+			"471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8",
+		},
+	}
+
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const masterPublicKey = "0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2"
+	if got := hex.EncodeToString(master.PrivateKey().PublicKey()); got != masterPublicKey {
+		t.Errorf("master public key %s, want %s", got, masterPublicKey)
+	}
+
+	for _, test := range tests {
+		key, err := master.Derive(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := FormatPath(test.path)
+		if got := hex.EncodeToString(key.ChainCode); got != test.chainCode {
+			t.Errorf("%s: chain code %s, want %s", path, got, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.Key); got != test.key {
+			t.Errorf("%s: key %s, want %s", path, got, test.key)
+		}
+		if int(key.Depth) != len(test.path) {
+			t.Errorf("%s: depth %d, want %d", path, key.Depth, len(test.path))
+		}
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	path := NewHDWallet(nil).Path(7)
+	if got, want := FormatPath(path), "m/44'/0'/0'/0/7"; got != want {
+		t.Fatalf("path %s, want %s", got, want)
+	}
+}
+
+// o primeiro endereço BIP44 da frase "abandon ... about" sem passphrase
+func TestHDWalletAddress(t *testing.T) {
+	seed, err := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewHDWallet(seed).Derive(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(w.Address()), "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"; got != want {
+		t.Fatalf("address %s, want %s", got, want)
+	}
+}
@@ -1,69 +1,331 @@
 package wallet
 
 import (
-	"blockchain-tutorial/utils"
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"bytes"
 	"crypto/rand"
-	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
-	secp256k1 "github.com/haltingstate/secp256k1-go"
+	"errors"
+	"fmt"
 	"math/big"
+
+	secp256k1 "github.com/haltingstate/secp256k1-go"
+	secp "github.com/haltingstate/secp256k1-go/secp256k1-go2"
+)
+
+const (
+	privateKeyLength   = 32
+	compressedLength   = 33
+	uncompressedLength = 65
+	signatureLength    = 65
 )
 
-func NewKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()
+var (
+	ErrInvalidKey = errors.New("invalid key")
+
+	// primo do corpo finito da curva secp256k1, y² = x³ + 7
+	curveP, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+
+	// metade da ordem da curva, o maior S aceito nas assinaturas
+	curveHalfOrder, _ = new(big.Int).SetString("7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF5D576E7357A4501DDFE92F46681B20A0", 16)
+
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// KeyType é o formato da chave publica gravada nas transações,
+// todas as chaves usam a curva secp256k1
+type KeyType byte
+
+const (
+	// chave publica de 65 bytes, usada pelas carteiras antigas
+	KeyUncompressed KeyType = iota + 1
+
+	// chave publica de 33 bytes, usada pelas carteiras novas
+	KeyCompressed
+)
+
+func (t KeyType) String() string {
+	switch t {
+	case KeyUncompressed:
+		return "uncompressed"
+	case KeyCompressed:
+		return "compressed"
+	}
+	return fmt.Sprintf("KeyType(%d)", byte(t))
+}
+
+// PrivateKey é uma chave privada secp256k1, o tipo define
+// o formato da chave publica e portanto o endereço da chave
+type PrivateKey struct {
+	Type KeyType
+	D    []byte
+}
+
+// gera uma nova chave privada aleatoria
+func NewPrivateKey(keyType KeyType) (PrivateKey, error) {
+	for {
+		d := make([]byte, privateKeyLength)
+		if _, err := rand.Read(d); err != nil {
+			return PrivateKey{}, err
+		}
+
+		key, err := ParsePrivateKey(d, keyType)
+		if err == nil {
+			return key, nil
+		}
+	}
+}
+
+// valida o escalar da chave privada, que deve estar entre 1 e a ordem da curva
+func ParsePrivateKey(d []byte, keyType KeyType) (PrivateKey, error) {
+	if keyType != KeyUncompressed && keyType != KeyCompressed {
+		return PrivateKey{}, fmt.Errorf("%w: unknown key type %d", ErrInvalidKey, byte(keyType))
+	}
+	if len(d) > privateKeyLength {
+		return PrivateKey{}, fmt.Errorf("%w: private key has %d bytes", ErrInvalidKey, len(d))
+	}
+
+	padded := make([]byte, privateKeyLength)
+	copy(padded[privateKeyLength-len(d):], d)
+
+	if secp256k1.VerifySeckey(padded) != 1 {
+		return PrivateKey{}, fmt.Errorf("%w: private key is out of the curve order", ErrInvalidKey)
+	}
+
+	return PrivateKey{Type: keyType, D: padded}, nil
+}
+
+func NewKeyPair() (PrivateKey, []byte, error) {
+	privateKey, err := NewPrivateKey(KeyCompressed)
+	if err != nil {
+		return PrivateKey{}, nil, err
+	}
+
+	return privateKey, privateKey.PublicKey(), nil
+}
+
+func NewKeyPairWith(pvtKeyHex string) (PrivateKey, []byte, error) {
+	if len(pvtKeyHex)%2 == 1 {
+		pvtKeyHex = "0" + pvtKeyHex
+	}
+
+	d, err := hex.DecodeString(pvtKeyHex)
+	if err != nil {
+		return PrivateKey{}, nil, fmt.Errorf("%w: private key is not hex encoded", ErrInvalidKey)
+	}
 
-	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
-	utils.HandleError(err)
+	privateKey, err := ParsePrivateKey(d, KeyCompressed)
+	if err != nil {
+		return PrivateKey{}, nil, err
+	}
 
-	//publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
-	publicKey := PublicKeySECP256K1(privateKey.D.Bytes())
+	return privateKey, privateKey.PublicKey(), nil
+}
+
+// retorna a chave publica no formato do tipo da chave
+func (k PrivateKey) PublicKey() []byte {
+	if k.Type == KeyUncompressed {
+		return secp256k1.UncompressedPubkeyFromSeckey(k.D)
+	}
+	return secp256k1.PubkeyFromSeckey(k.D)
+}
+
+// assina o hash, a assinatura possui 65 bytes: R, S e o id de recuperação
+func (k PrivateKey) Sign(hash []byte) ([]byte, error) {
+	if len(k.D) != privateKeyLength || secp256k1.VerifySeckey(k.D) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if len(hash) == 0 {
+		return nil, errors.New("nothing to sign")
+	}
+
+	return secp256k1.Sign(hash, k.D), nil
+}
+
+// verifica a assinatura do hash com uma chave publica de qualquer tipo
+func VerifySignature(publicKey, hash, signature []byte) bool {
+	compressed, _, err := ParsePublicKey(publicKey)
+	if err != nil || len(hash) == 0 || len(signature) != signatureLength {
+		return false
+	}
+
+	// S deve ser no maximo metade da ordem da curva, como nas assinaturas
+	// criadas por Sign, senão n - S seria outra assinatura valida do mesmo hash.
+	// O id de recuperação fica entre 0 e 3
+	s := new(big.Int).SetBytes(signature[32:64])
+	if s.Cmp(curveHalfOrder) > 0 || signature[64] >= 4 {
+		return false
+	}
 
-	return *privateKey, publicKey
+	recovered, ret := secp.RecoverPublicKey(signature[:64], hash, int(signature[64]))
+	return ret == 1 && bytes.Equal(recovered, compressed)
 }
 
-func NewKeyPairWith(pvtKeyHex string) (ecdsa.PrivateKey, []byte) {
+// valida a chave publica, retornando o seu tipo e
+// a mesma chave no formato comprimido
+func ParsePublicKey(publicKey []byte) ([]byte, KeyType, error) {
+	switch {
+	case len(publicKey) == compressedLength && (publicKey[0] == 0x02 || publicKey[0] == 0x03):
+		x := new(big.Int).SetBytes(publicKey[1:])
+		if curveY(x, publicKey[0] == 0x03) == nil {
+			return nil, 0, fmt.Errorf("%w: point is not on the curve", ErrInvalidKey)
+		}
+		return publicKey, KeyCompressed, nil
 
-	var pri ecdsa.PrivateKey
-	pri.D, _ = new(big.Int).SetString(pvtKeyHex,16)
-	pri.PublicKey.Curve = elliptic.P256()
-	pri.PublicKey.X, pri.PublicKey.Y = pri.PublicKey.Curve.ScalarBaseMult(pri.D.Bytes())
+	case len(publicKey) == uncompressedLength && publicKey[0] == 0x04:
+		x := new(big.Int).SetBytes(publicKey[1:33])
+		y := new(big.Int).SetBytes(publicKey[33:])
+		expected := curveY(x, y.Bit(0) == 1)
+		if expected == nil || expected.Cmp(y) != 0 {
+			return nil, 0, fmt.Errorf("%w: point is not on the curve", ErrInvalidKey)
+		}
 
-	//publicKey := append(pri.PublicKey.X.Bytes(), pri.PublicKey.Y.Bytes()...)
-	publicKey := PublicKeySECP256K1(pri.D.Bytes())
+		compressed := make([]byte, compressedLength)
+		compressed[0] = 0x02 | byte(y.Bit(0))
+		copy(compressed[1:], publicKey[1:33])
+		return compressed, KeyUncompressed, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: public key has %d bytes", ErrInvalidKey, len(publicKey))
+}
+
+// calcula o y do ponto com a coordenada x e a paridade informada,
+// retorna nil se o ponto não estiver na curva
+func curveY(x *big.Int, odd bool) *big.Int {
+	if x.Cmp(curveP) >= 0 {
+		return nil
+	}
+
+	// x³ + 7
+	y2 := new(big.Int).Exp(x, big.NewInt(3), curveP)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, curveP)
+
+	// como p ≡ 3 mod 4 a raiz é y2^((p+1)/4)
+	exponent := new(big.Int).Add(curveP, big.NewInt(1))
+	exponent.Rsh(exponent, 2)
+	y := new(big.Int).Exp(y2, exponent, curveP)
+
+	if new(big.Int).Exp(y, big.NewInt(2), curveP).Cmp(y2) != 0 {
+		return nil
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(curveP, y)
+	}
+	return y
+}
 
-	return pri, publicKey
+// estrutura SEC 1 das chaves privadas de curvas elipticas
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
 }
 
-func PublicKeySECP256K1(pvtKey []byte) []byte {
-	return secp256k1.UncompressedPubkeyFromSeckey(pvtKey)
+type pkixPublicKey struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
 }
 
-func PrivateKeyEncode(pvtKey ecdsa.PrivateKey) []byte {
-	x509Encoded, err := x509.MarshalECPrivateKey(&pvtKey)
-	utils.HandleError(err)
-	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
+func PrivateKeyEncode(pvtKey PrivateKey) ([]byte, error) {
+	publicKey := pvtKey.PublicKey()
+
+	der, err := asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    pvtKey.D,
+		NamedCurveOID: oidSecp256k1,
+		PublicKey:     asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
 }
 
-func PublicKeyEncode(pubKey ecdsa.PublicKey) []byte {
-	x509EncodedPup, err := x509.MarshalPKIXPublicKey(&pubKey)
-	utils.HandleError(err)
-	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPup})
+func PublicKeyEncode(pubKey []byte) ([]byte, error) {
+	if _, _, err := ParsePublicKey(pubKey); err != nil {
+		return nil, err
+	}
+
+	params, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := asn1.Marshal(pkixPublicKey{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{Bytes: pubKey, BitLength: 8 * len(pubKey)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
 }
 
-func PrivateKeyDecode(privateKey []byte) *ecdsa.PrivateKey {
+// lê uma chave privada secp256k1 no formato SEC 1, a chave publica
+// contida no PEM define o tipo da chave
+func PrivateKeyDecode(privateKey []byte) (PrivateKey, error) {
 	block, _ := pem.Decode(privateKey)
-	x509Encoded := block.Bytes
-	pvtKey, err := x509.ParseECPrivateKey(x509Encoded)
-	utils.HandleError(err)
-	return pvtKey
+	if block == nil {
+		return PrivateKey{}, fmt.Errorf("%w: no PEM data found", ErrInvalidKey)
+	}
+
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+		return PrivateKey{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if len(key.NamedCurveOID) > 0 && !key.NamedCurveOID.Equal(oidSecp256k1) {
+		return PrivateKey{}, fmt.Errorf("%w: curve %v is not secp256k1", ErrInvalidKey, key.NamedCurveOID)
+	}
+
+	keyType := KeyCompressed
+	if len(key.PublicKey.Bytes) == uncompressedLength {
+		keyType = KeyUncompressed
+	}
+
+	pvtKey, err := ParsePrivateKey(key.PrivateKey, keyType)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	if len(key.PublicKey.Bytes) > 0 && !bytes.Equal(key.PublicKey.Bytes, pvtKey.PublicKey()) {
+		return PrivateKey{}, fmt.Errorf("%w: public key does not match the private key", ErrInvalidKey)
+	}
+
+	return pvtKey, nil
 }
 
-func PublicKeyDecode(publicKey []byte) *ecdsa.PublicKey {
+func PublicKeyDecode(publicKey []byte) ([]byte, error) {
 	block, _ := pem.Decode(publicKey)
-	x509EncodedPub := block.Bytes
-	pubKey, err := x509.ParsePKIXPublicKey(x509EncodedPub)
-	utils.HandleError(err)
-	return pubKey.(*ecdsa.PublicKey)
-}
\ No newline at end of file
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found", ErrInvalidKey)
+	}
+
+	var key pkixPublicKey
+	if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	var curve asn1.ObjectIdentifier
+	if !key.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("%w: not an ECDSA public key", ErrInvalidKey)
+	}
+	if _, err := asn1.Unmarshal(key.Algorithm.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidSecp256k1) {
+		return nil, fmt.Errorf("%w: curve is not secp256k1", ErrInvalidKey)
+	}
+
+	if _, _, err := ParsePublicKey(key.PublicKey.Bytes); err != nil {
+		return nil, err
+	}
+
+	return key.PublicKey.Bytes, nil
+}
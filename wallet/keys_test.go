@@ -0,0 +1,211 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	secp256k1 "github.com/haltingstate/secp256k1-go"
+)
+
+// as versões antigas gravavam a ecdsa.PrivateKey da curva P-256 com o gob, a
+// curva era um elliptic.p256Curve registrado com gob.Register(elliptic.P256()).
+// O gob das versões atuais não grava mais essa curva, então os tipos abaixo
+// reproduzem os mesmos campos e o mesmo nome registrado
+type oldP256Curve struct {
+	*elliptic.CurveParams
+}
+
+type oldWallet struct {
+	PrivateKey struct {
+		PublicKey struct {
+			Curve elliptic.Curve
+			X, Y  *big.Int
+		}
+		D *big.Int
+	}
+	PublicKey []byte
+}
+
+type oldWalletSet struct {
+	Wallets map[string]*oldWallet
+}
+
+func init() {
+	gob.RegisterName("elliptic.p256Curve", oldP256Curve{})
+}
+
+// grava um arquivo de carteiras no formato antigo, com o escalar da curva
+// P-256 e a chave publica não comprimida da secp256k1, e o carrega
+func upgradedLegacyKey(t *testing.T) PrivateKey {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	walletFile := WalletFile
+	WalletFile = filepath.Join(dir, "wallets.data")
+	defer func() { WalletFile = walletFile }()
+
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := make([]byte, privateKeyLength)
+	copy(d[privateKeyLength-len(p256Key.D.Bytes()):], p256Key.D.Bytes())
+
+	old := &oldWallet{PublicKey: secp256k1.UncompressedPubkeyFromSeckey(d)}
+	old.PrivateKey.PublicKey.Curve = oldP256Curve{elliptic.P256().Params()}
+	old.PrivateKey.PublicKey.X, old.PrivateKey.PublicKey.Y = p256Key.X, p256Key.Y
+	old.PrivateKey.D = p256Key.D
+	address := string(Wallet{PublicKey: old.PublicKey}.Address())
+
+	var content bytes.Buffer
+	legacy := oldWalletSet{Wallets: map[string]*oldWallet{address: old}}
+	if err := gob.NewEncoder(&content).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(WalletFile, content.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := LoadWallets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := ioutil.ReadFile(legacyBackupFile())
+	if err != nil || !bytes.Equal(backup, content.Bytes()) {
+		t.Fatalf("the original file was not kept as a backup: %v", err)
+	}
+
+	upgraded, ok := ws.Wallets[address]
+	if !ok {
+		t.Fatalf("address %s was not kept by the upgrade", address)
+	}
+	if upgraded.PrivateKey.Type != KeyUncompressed {
+		t.Fatalf("upgraded key is %s, want %s", upgraded.PrivateKey.Type, KeyUncompressed)
+	}
+	if got := string(upgraded.Address()); got != address {
+		t.Fatalf("upgraded address %s, want %s", got, address)
+	}
+
+	return upgraded.PrivateKey
+}
+
+func TestSignVerify(t *testing.T) {
+	compressed, err := NewPrivateKey(KeyCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed, err := NewPrivateKey(KeyUncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewPrivateKey(KeyCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  PrivateKey
+		size int
+	}{
+		{"compressed", compressed, compressedLength},
+		{"uncompressed", uncompressed, uncompressedLength},
+		{"upgraded legacy", upgradedLegacyKey(t), uncompressedLength},
+	}
+
+	hash := sha256.Sum256([]byte("transaction"))
+	otherHash := sha256.Sum256([]byte("another transaction"))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			publicKey := test.key.PublicKey()
+			if len(publicKey) != test.size {
+				t.Fatalf("public key has %d bytes, want %d", len(publicKey), test.size)
+			}
+
+			signature, err := test.key.Sign(hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !VerifySignature(publicKey, hash[:], signature) {
+				t.Error("signature rejected by its own key")
+			}
+			if VerifySignature(other.PublicKey(), hash[:], signature) {
+				t.Error("signature accepted by the wrong key")
+			}
+			if VerifySignature(publicKey, otherHash[:], signature) {
+				t.Error("signature accepted for another hash")
+			}
+
+			tampered := append([]byte{}, signature...)
+			tampered[10] ^= 0x01
+			if VerifySignature(publicKey, hash[:], tampered) {
+				t.Error("tampered signature accepted")
+			}
+		})
+	}
+}
+
+func bytes32(n *big.Int) []byte {
+	b := n.Bytes()
+	padded := make([]byte, 32)
+	copy(padded[32-len(b):], b)
+	return padded
+}
+
+// n - S também é uma assinatura valida do mesmo hash, então S maior que metade
+// da ordem deve ser rejeitado, mesmo quando o bit mais alto de S é zero
+func TestVerifySignatureRejectsHighS(t *testing.T) {
+	key, err := NewPrivateKey(KeyCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := NewPrivateKey(KeyCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := new(big.Int).Add(new(big.Int).Lsh(curveHalfOrder, 1), big.NewInt(1))
+
+	// R = k*G, o id de recuperação é a paridade do y de R
+	point := nonce.PublicKey()
+	r := new(big.Int).SetBytes(point[1:])
+	recid := point[0] & 1
+
+	// com S = n/2 escolhido, o hash é z = S*k - r*d, assim n - S = n/2 + 1
+	// fica acima da metade da ordem com o bit mais alto ainda zero
+	s := new(big.Int).Set(curveHalfOrder)
+	z := new(big.Int).Mul(s, new(big.Int).SetBytes(nonce.D))
+	z.Sub(z, new(big.Int).Mul(r, new(big.Int).SetBytes(key.D)))
+	z.Mod(z, order)
+	hash := bytes32(z)
+
+	low := append(append(bytes32(r), bytes32(s)...), recid)
+	if !VerifySignature(key.PublicKey(), hash, low) {
+		t.Fatal("low S signature rejected")
+	}
+
+	highS := new(big.Int).Sub(order, s)
+	if highS.Bit(255) != 0 {
+		t.Fatal("high S should have the top bit clear")
+	}
+	high := append(append(bytes32(r), bytes32(highS)...), recid^1)
+	if VerifySignature(key.PublicKey(), hash, high) {
+		t.Error("high S signature accepted")
+	}
+}
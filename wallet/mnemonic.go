@@ -0,0 +1,122 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// 128 bits de entropia geram uma frase de 12 palavras
+	DefaultEntropyBits = 128
+
+	seedIterations = 2048
+	seedLength     = 64
+)
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+)
+
+// gera uma frase mnemonica BIP39 com a entropia informada,
+// que deve ser multipla de 32 bits entre 128 e 256
+func NewMnemonic(entropyBits int) (string, error) {
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", fmt.Errorf("invalid entropy size %d", entropyBits)
+	}
+
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+
+	return EntropyToMnemonic(entropy)
+}
+
+// cada palavra representa 11 bits da entropia seguida do checksum,
+// os primeiros bits do sha256 da entropia
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("invalid entropy size %d", bits)
+	}
+
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumBits))
+	data.Or(data, big.NewInt(int64(hash[0]>>uint(8-checksumBits))))
+
+	words := make([]string, (bits+checksumBits)/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		index := new(big.Int).And(data, mask)
+		words[i] = wordlist[index.Int64()]
+		data.Rsh(data, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// retorna a entropia da frase, validando as palavras e o checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: expected 12, 15, 18, 21 or 24 words, got %d", ErrInvalidMnemonic, len(words))
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex(word)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumBits := len(words) * 11 / 33
+	checksum := new(big.Int).And(data, big.NewInt(int64(1)<<uint(checksumBits)-1))
+	data.Rsh(data, uint(checksumBits))
+
+	entropy := make([]byte, checksumBits*4)
+	raw := data.Bytes()
+	copy(entropy[len(entropy)-len(raw):], raw)
+
+	hash := sha256.Sum256(entropy)
+	if int64(hash[0]>>uint(8-checksumBits)) != checksum.Int64() {
+		return nil, fmt.Errorf("%w: checksum does not match", ErrInvalidMnemonic)
+	}
+
+	return entropy, nil
+}
+
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+// deriva a semente BIP39 da frase, o passphrase é opcional
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normalized := strings.ToLower(strings.Join(strings.Fields(mnemonic), " "))
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), seedIterations, seedLength, sha512.New), nil
+}
+
+// a lista esta em ordem alfabetica, então a busca é binaria
+func wordIndex(word string) (int, bool) {
+	word = strings.ToLower(word)
+	index := sort.SearchStrings(wordlist, word)
+	return index, index < len(wordlist) && wordlist[index] == word
+}
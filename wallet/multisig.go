@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"blockchain-tutorial/script"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	MaxMultisigKeys = script.MaxMultisigKeys
+)
+
+var (
+	// primeiro byte dos endereços multisig, muda de acordo com a rede
+	MultisigVersion = byte(0x05)
+
+	ErrInvalidMultisig = errors.New("invalid multisig script")
+	ErrMultisigAddress = errors.New("address is multisig")
+)
+
+// MultisigScript trava um output a M de N chaves publicas, as chaves ficam
+// em ordem crescente para que todos os participantes cheguem ao mesmo endereço
+type MultisigScript struct {
+	M          int
+	PublicKeys [][]byte
+}
+
+func NewMultisigScript(m int, publicKeys [][]byte) (*MultisigScript, error) {
+	n := len(publicKeys)
+	if n == 0 || n > MaxMultisigKeys {
+		return nil, fmt.Errorf("%w: %d keys, expected 1 to %d", ErrInvalidMultisig, n, MaxMultisigKeys)
+	}
+	if m < 1 || m > n {
+		return nil, fmt.Errorf("%w: %d signatures required of %d keys", ErrInvalidMultisig, m, n)
+	}
+
+	keys := make([][]byte, n)
+	for index, publicKey := range publicKeys {
+		if _, _, err := ParsePublicKey(publicKey); err != nil {
+			return nil, err
+		}
+		keys[index] = append([]byte{}, publicKey...)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	for index := 1; index < n; index++ {
+		if bytes.Equal(keys[index-1], keys[index]) {
+			return nil, fmt.Errorf("%w: duplicated key %x", ErrInvalidMultisig, keys[index])
+		}
+	}
+
+	return &MultisigScript{M: m, PublicKeys: keys}, nil
+}
+
+// serializa como o script OP_M <chave>... OP_N OP_CHECKMULTISIG
+func (s *MultisigScript) Serialize() []byte {
+	return script.MultisigScript(s.M, s.PublicKeys)
+}
+
+func ParseMultisigScript(data []byte) (*MultisigScript, error) {
+	m, publicKeys, err := script.ParseMultisig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisig, err)
+	}
+
+	multisig, err := NewMultisigScript(m, publicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	// somente a serialização canonica, com as chaves em ordem, é aceita
+	for index, publicKey := range multisig.PublicKeys {
+		if !bytes.Equal(publicKey, publicKeys[index]) {
+			return nil, fmt.Errorf("%w: keys are not sorted", ErrInvalidMultisig)
+		}
+	}
+
+	return multisig, nil
+}
+
+// hash do script, que trava os outputs assim como o hash de uma chave publica
+func (s *MultisigScript) Hash() []byte {
+	return PublicKeyHash(s.Serialize())
+}
+
+func (s *MultisigScript) Address() string {
+	return AddressFromScriptHash(s.Hash())
+}
+
+// posição da chave no script, ou -1 se ela não fizer parte dele
+func (s *MultisigScript) KeyIndex(publicKey []byte) int {
+	for index, key := range s.PublicKeys {
+		if bytes.Equal(key, publicKey) {
+			return index
+		}
+	}
+	return -1
+}
+
+// retorna o endereço multisig correspondente ao hash de um script
+func AddressFromScriptHash(scriptHash []byte) string {
+	versionedHash := append([]byte{MultisigVersion}, scriptHash...)
+	return string(Base58Encode(append(versionedHash, Checksum(versionedHash)...)))
+}
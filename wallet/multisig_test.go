@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"blockchain-tutorial/script"
+	"errors"
+	"testing"
+)
+
+func newTestPublicKeys(t *testing.T, count int) [][]byte {
+	var publicKeys [][]byte
+	for i := 0; i < count; i++ {
+		_, publicKey, err := NewKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys
+}
+
+func TestNewMultisigScript(t *testing.T) {
+	keys := newTestPublicKeys(t, 3)
+
+	multisig, err := NewMultisigScript(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a ordem das chaves informadas não muda o endereço
+	reversed, err := NewMultisigScript(2, [][]byte{keys[2], keys[1], keys[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multisig.Address() != reversed.Address() {
+		t.Fatal("the same keys in another order gave a different address")
+	}
+
+	for _, key := range keys {
+		if index := multisig.KeyIndex(key); index < 0 || string(multisig.PublicKeys[index]) != string(key) {
+			t.Errorf("key %x has index %d", key, index)
+		}
+	}
+	if index := multisig.KeyIndex(newTestPublicKeys(t, 1)[0]); index != -1 {
+		t.Errorf("a key outside the script has index %d", index)
+	}
+
+	tests := []struct {
+		name string
+		m    int
+		keys [][]byte
+	}{
+		{"no keys", 1, nil},
+		{"no signatures", 0, keys},
+		{"more signatures than keys", 4, keys},
+		{"duplicated key", 2, [][]byte{keys[0], keys[1], keys[0]}},
+		{"too many keys", 1, newTestPublicKeys(t, MaxMultisigKeys+1)},
+	}
+
+	for _, test := range tests {
+		if _, err := NewMultisigScript(test.m, test.keys); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidMultisig)
+		}
+	}
+
+	if _, err := NewMultisigScript(1, [][]byte{[]byte("not a public key")}); err == nil {
+		t.Error("an invalid public key was accepted")
+	}
+}
+
+func TestParseMultisigScript(t *testing.T) {
+	keys := newTestPublicKeys(t, 3)
+
+	multisig, err := NewMultisigScript(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseMultisigScript(multisig.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.M != 2 || parsed.Address() != multisig.Address() {
+		t.Fatalf("parsed %d of %d keys with address %s, want 2 of 3 with %s", parsed.M, len(parsed.PublicKeys), parsed.Address(), multisig.Address())
+	}
+
+	sorted := multisig.PublicKeys
+	unsorted := script.MultisigScript(2, [][]byte{sorted[1], sorted[0], sorted[2]})
+	duplicated := script.MultisigScript(2, [][]byte{sorted[0], sorted[0], sorted[1]})
+
+	for _, data := range [][]byte{unsorted, duplicated, {script.OP_1}, nil} {
+		if _, err := ParseMultisigScript(data); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("script %s: got %v, want %v", script.Disassemble(data), err, ErrInvalidMultisig)
+		}
+	}
+}
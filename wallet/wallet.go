@@ -1,71 +1,63 @@
 package wallet
 
 import (
-	"blockchain-tutorial/utils"
 	"bytes"
-	"crypto/ecdsa"
 	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/ripemd160"
-	"log"
 )
 
 const (
 	checksumLength = 4
-	version        = byte(0x00)
+	// tamanho do RIPEMD160 da chave publica ou do script multisig
+	hashLength = 20
 )
 
 var (
+	// primeiro byte dos endereços, muda de acordo com a rede
+	Version = byte(0x00)
+
 	ErrInvalidAddress = errors.New("address is not valid")
 )
 
 type Wallet struct {
-	PrivateKey ecdsa.PrivateKey
+	PrivateKey PrivateKey
 	PublicKey  []byte
+
+	// caminho BIP32 da chave, vazio nas carteiras aleatorias
+	Path string
 }
 
 func (w Wallet) Address() []byte {
-	pvtKey := hex.EncodeToString(w.PrivateKeyHash())
-	fmt.Printf("PRIVATE KEY:  %s\n", pvtKey)
-
-	fmt.Printf("PUBLIC KEY:   %x\n", w.PublicKey)
-
 	publicKeyHash := PublicKeyHash(w.PublicKey)
-	fmt.Printf("RIPEMD160:    %x\n", publicKeyHash)
-
-	versionedHash := append([]byte{version}, publicKeyHash...)
-	fmt.Printf("VERSION+HASH: %x\n", versionedHash)
 
+	versionedHash := append([]byte{Version}, publicKeyHash...)
 	checksum := Checksum(versionedHash)
-	fmt.Printf("CHECKSUM:     %x\n", checksum)
-
 	fullHash := append(versionedHash, checksum...)
-	fmt.Printf("FULLHASH:     %x\n", fullHash)
 
-	address := Base58Encode(fullHash)
-	fmt.Printf("ADDRESS:      %s\n", address)
-
-	return address
+	return Base58Encode(fullHash)
 }
 
 func (w Wallet) PrivateKeyHash() []byte {
-	return w.PrivateKey.D.Bytes()
+	return w.PrivateKey.D
 }
 
-func CreateWallet() *Wallet {
-	privateKey, publicKey := NewKeyPair()
+func CreateWallet() (*Wallet, error) {
+	privateKey, publicKey, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
 
-	return &Wallet{PrivateKey: privateKey, PublicKey: publicKey}
+	return &Wallet{PrivateKey: privateKey, PublicKey: publicKey}, nil
 }
 
 func PublicKeyHash(publicKey []byte) []byte {
 	publicKeyHash := sha256.Sum256(publicKey)
 
+	// o Write de um hash.Hash nunca retorna erro
 	hasher := ripemd160.New()
-	_, err := hasher.Write(publicKeyHash[:])
-	utils.HandleError(err)
+	hasher.Write(publicKeyHash[:])
 
 	return hasher.Sum(nil)
 }
@@ -76,16 +68,49 @@ func Checksum(payload []byte) []byte {
 	return secondHash[:checksumLength]
 }
 
+// retorna o endereço correspondente ao hash de uma chave publica
+func AddressFromPublicKeyHash(publicKeyHash []byte) string {
+	versionedHash := append([]byte{Version}, publicKeyHash...)
+	return string(Base58Encode(append(versionedHash, Checksum(versionedHash)...)))
+}
+
+func ValidateAddress(address string) error {
+	_, _, err := DecodeAddress(address)
+	return err
+}
 
-func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1:len(pubKeyHash)-checksumLength]
-	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
-	isValid := bytes.Compare(actualChecksum, targetChecksum) == 0
-	if isValid {
-		log.Println("Address is Valid: ", address)
+// retorna o hash contido no endereço, que pode ser o hash de uma chave
+// publica ou de um script multisig
+func PublicKeyHashFromAddress(address string) ([]byte, error) {
+	hash, _, err := DecodeAddress(address)
+	return hash, err
+}
+
+// retorna o hash contido no endereço e se ele é multisig,
+// validando o checksum e a versão da rede
+func DecodeAddress(address string) ([]byte, bool, error) {
+	fullHash, err := Base58Decode([]byte(address))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	if len(fullHash) != 1+hashLength+checksumLength {
+		return nil, false, fmt.Errorf("%w: %q has an invalid length", ErrInvalidAddress, address)
+	}
+
+	versionedHash := fullHash[:len(fullHash)-checksumLength]
+	actualChecksum := fullHash[len(fullHash)-checksumLength:]
+
+	if !bytes.Equal(actualChecksum, Checksum(versionedHash)) {
+		return nil, false, fmt.Errorf("%w: %q has an invalid checksum", ErrInvalidAddress, address)
 	}
-	return isValid
+
+	switch versionedHash[0] {
+	case Version:
+		return versionedHash[1:], false, nil
+	case MultisigVersion:
+		return versionedHash[1:], true, nil
+	}
+
+	return nil, false, fmt.Errorf("%w: %q belongs to another network", ErrInvalidAddress, address)
 }
@@ -1,30 +1,70 @@
 package wallet
 
 import (
-	"blockchain-tutorial/utils"
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
+	"path/filepath"
 )
 
-const walletFile = "./tmp/wallets.data"
+var (
+	// arquivo onde as carteiras são gravadas
+	WalletFile = "./tmp/wallets.data"
+
+	ErrWalletNotFound = errors.New("wallet not found")
+)
 
 type WalletSet struct {
 	Wallets map[string]*Wallet
+
+	// endereços observados sem a chave privada, com o hash da chave publica
+	WatchOnly map[string][]byte
+
+	// scripts multisig conhecidos pela carteira, pelo endereço
+	Multisig map[string][]byte
+
+	// nome dado a cada endereço, com ou sem chave privada
+	Labels map[string]string
+
+	// semente das carteiras HD, nil nos arquivos sem frase mnemonica
+	HD *HDWallet
+
+	// senha do arquivo, nil quando ele não é criptografado
+	passphrase []byte
 }
 
+// carrega as carteiras do arquivo, um arquivo inexistente
+// resulta em um conjunto vazio
 func LoadWallets() (*WalletSet, error) {
-	wallets := WalletSet{Wallets: make(map[string]*Wallet)}
+	wallets := WalletSet{
+		Wallets:   make(map[string]*Wallet),
+		WatchOnly: make(map[string][]byte),
+		Multisig:  make(map[string][]byte),
+		Labels:    make(map[string]string),
+	}
 	err := wallets.LoadFile()
+	if os.IsNotExist(err) {
+		return &wallets, nil
+	}
 	return &wallets, err
 }
 
-func(ws WalletSet) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+func (ws WalletSet) GetWallet(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		if ws.IsWatchOnly(address) {
+			return Wallet{}, fmt.Errorf("%w: %s", ErrWatchOnly, address)
+		}
+		if ws.IsMultisig(address) {
+			return Wallet{}, fmt.Errorf("%w: %s", ErrMultisigAddress, address)
+		}
+		return Wallet{}, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+	return *wallet, nil
 }
 
 func (ws *WalletSet) GetAddresses() []string {
@@ -37,36 +77,238 @@ func (ws *WalletSet) GetAddresses() []string {
 	return addresses
 }
 
-func (ws *WalletSet) AddWallet() (string, string) {
-	wallet := CreateWallet()
+// cria uma nova carteira, derivada da semente quando houver uma
+func (ws *WalletSet) AddWallet() (string, error) {
+	var wallet *Wallet
+	var err error
+	if ws.HD != nil {
+		wallet, err = ws.HD.Next()
+	} else {
+		wallet, err = CreateWallet()
+	}
+	if err != nil {
+		return "", err
+	}
 	address := fmt.Sprintf("%s", wallet.Address())
 	ws.Wallets[address] = wallet
-	return address, hex.EncodeToString(wallet.PrivateKeyHash())
+	return address, nil
+}
+
+// adiciona uma chave gerada fora do conjunto, retornando o seu
+// endereço e se ela ainda não fazia parte das carteiras
+func (ws *WalletSet) ImportPrivateKey(privateKey PrivateKey) (string, bool) {
+	publicKey := privateKey.PublicKey()
+	address := AddressFromPublicKeyHash(PublicKeyHash(publicKey))
+
+	if _, ok := ws.Wallets[address]; ok {
+		return address, false
+	}
+
+	ws.Wallets[address] = &Wallet{PrivateKey: privateKey, PublicKey: publicKey}
+	delete(ws.WatchOnly, address)
+	return address, true
+}
+
+// define a semente das carteiras HD, um conjunto só pode ter uma semente
+func (ws *WalletSet) SetSeed(seed []byte) error {
+	if ws.HD != nil {
+		if !bytes.Equal(ws.HD.Seed, seed) {
+			return ErrSeedExists
+		}
+		return nil
+	}
+
+	if _, err := NewMasterKey(seed); err != nil {
+		return err
+	}
+
+	ws.HD = NewHDWallet(seed)
+	return nil
+}
+
+// deriva os endereços da semente até encontrar gapLimit endereços seguidos
+// sem uso, adicionando todos até o ultimo usado, e retorna os adicionados
+func (ws *WalletSet) Restore(seed []byte, gapLimit int, used func(publicKeyHash []byte) bool) ([]string, error) {
+	if gapLimit <= 0 {
+		return nil, fmt.Errorf("invalid gap limit %d", gapLimit)
+	}
+	if err := ws.SetSeed(seed); err != nil {
+		return nil, err
+	}
+
+	var derived []*Wallet
+	var indexes []uint32
+	last := -1
+
+	for index, gap := uint32(0), 0; gap < gapLimit; index++ {
+		wallet, err := ws.HD.Derive(index)
+		if errors.Is(err, ErrInvalidChild) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		derived = append(derived, wallet)
+		indexes = append(indexes, index)
+
+		if used(PublicKeyHash(wallet.PublicKey)) {
+			last = len(derived) - 1
+			gap = 0
+		} else {
+			gap++
+		}
+	}
+
+	var addresses []string
+	for i := 0; i <= last; i++ {
+		address := AddressFromPublicKeyHash(PublicKeyHash(derived[i].PublicKey))
+		if _, ok := ws.Wallets[address]; !ok {
+			ws.Wallets[address] = derived[i]
+			addresses = append(addresses, address)
+		}
+	}
+
+	if last >= 0 && indexes[last] >= ws.HD.NextIndex {
+		ws.HD.NextIndex = indexes[last] + 1
+	}
+
+	return addresses, nil
 }
 
 func (ws *WalletSet) LoadFile() error {
-	_, err := os.Stat(walletFile)
+	_, err := os.Stat(WalletFile)
 	if os.IsNotExist(err) {
 		return err
 	}
 
-	content, err := ioutil.ReadFile(walletFile)
-	utils.HandleError(err)
+	content, err := ioutil.ReadFile(WalletFile)
+	if err != nil {
+		return err
+	}
+
+	if isEncrypted(content) {
+		if Passphrase == nil {
+			return ErrPassphraseRequired
+		}
+
+		passphrase, err := Passphrase()
+		if err != nil {
+			return err
+		}
+
+		content, err = decrypt(content, passphrase)
+		if err != nil {
+			return err
+		}
+		ws.passphrase = passphrase
+	}
 
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(content))
 
-	return decoder.Decode(ws)
+	if err := decoder.Decode(ws); err != nil {
+		// arquivos antigos guardam uma ecdsa.PrivateKey da curva P-256
+		if legacyErr := ws.upgradeLegacyFile(content); legacyErr != nil {
+			return fmt.Errorf("decode %s: %w", WalletFile, err)
+		}
+	}
+	return nil
+}
+
+// as carteiras antigas geravam o escalar com a curva P-256, mas derivavam
+// a chave publica não comprimida, e o endereço, com a curva secp256k1
+type legacyWallet struct {
+	PrivateKey struct {
+		D *big.Int
+	}
+	PublicKey []byte
+}
+
+type legacyWalletSet struct {
+	Wallets map[string]*legacyWallet
 }
 
-func (ws *WalletSet) SaveFile() {
+// copia do arquivo antigo guardada pela conversão das carteiras
+func legacyBackupFile() string {
+	return WalletFile + ".legacy"
+}
+
+// converte as carteiras antigas para chaves secp256k1 não comprimidas, que
+// mantém os mesmos endereços, guardando uma copia do arquivo original. A copia
+// não é criptografada, então ela só é guardada quando o arquivo também não é
+func (ws *WalletSet) upgradeLegacyFile(content []byte) error {
+	var legacy legacyWalletSet
+
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	if err := decoder.Decode(&legacy); err != nil {
+		return err
+	}
+
+	ws.Wallets = make(map[string]*Wallet)
+	for address, old := range legacy.Wallets {
+		if old.PrivateKey.D == nil {
+			return fmt.Errorf("%w: wallet %s has no private key", ErrInvalidKey, address)
+		}
+
+		privateKey, err := ParsePrivateKey(old.PrivateKey.D.Bytes(), KeyUncompressed)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(privateKey.PublicKey(), old.PublicKey) {
+			return fmt.Errorf("%w: wallet %s does not match its private key", ErrInvalidKey, address)
+		}
+
+		ws.Wallets[address] = &Wallet{PrivateKey: privateKey, PublicKey: old.PublicKey}
+	}
+
+	if !ws.IsEncrypted() {
+		if err := ioutil.WriteFile(legacyBackupFile(), content, 0600); err != nil {
+			return err
+		}
+	}
+
+	return ws.SaveFile()
+}
+
+// grava o arquivo, criptografado quando o conjunto possui uma senha,
+// em um arquivo temporario que depois substitui o original
+func (ws *WalletSet) SaveFile() error {
 	var content bytes.Buffer
 
-	gob.Register(elliptic.P256())
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
-	utils.HandleError(err)
+	if err := encoder.Encode(ws); err != nil {
+		return fmt.Errorf("encode wallets: %w", err)
+	}
+
+	data := content.Bytes()
+	if ws.IsEncrypted() {
+		encrypted, err := encrypt(data, ws.passphrase)
+		if err != nil {
+			return fmt.Errorf("encrypt wallets: %w", err)
+		}
+		data = encrypted
+	}
+
+	if err := os.MkdirAll(filepath.Dir(WalletFile), 0755); err != nil {
+		return err
+	}
+
+	tmpFile := WalletFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile, WalletFile); err != nil {
+		return err
+	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
-	utils.HandleError(err)
-}
\ No newline at end of file
+	// as chaves da copia antiga estão no arquivo criptografado,
+	// ela não pode continuar no disco sem criptografia
+	if ws.IsEncrypted() {
+		if err := os.Remove(legacyBackupFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
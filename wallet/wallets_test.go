@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a copia do arquivo antigo não é criptografada e deve ser apagada
+// quando o arquivo passa a ser gravado criptografado
+func TestEncryptRemovesLegacyBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	walletFile := WalletFile
+	WalletFile = filepath.Join(dir, "wallets.data")
+	defer func() { WalletFile = walletFile }()
+
+	if err := ioutil.WriteFile(legacyBackupFile(), []byte("old wallet"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &WalletSet{Wallets: make(map[string]*Wallet)}
+	if _, err := ws.AddWallet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacyBackupFile()); err != nil {
+		t.Fatalf("backup removed from an unencrypted wallet: %v", err)
+	}
+
+	if err := ws.Encrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(WalletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(content) {
+		t.Fatal("wallet file was not encrypted")
+	}
+	if _, err := os.Stat(legacyBackupFile()); !os.IsNotExist(err) {
+		t.Fatalf("unencrypted backup still on disk: %v", err)
+	}
+}
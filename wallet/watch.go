@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrWatchOnly  = errors.New("address is watch-only")
+	ErrHasPrivKey = errors.New("address already has its private key in the wallet")
+)
+
+// adiciona um endereço observado, sem chave privada, retornando
+// se ele ainda não fazia parte das carteiras
+func (ws *WalletSet) AddWatchOnly(address string) (bool, error) {
+	publicKeyHash, err := PublicKeyHashFromAddress(address)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := ws.Wallets[address]; ok {
+		return false, fmt.Errorf("%w: %s", ErrHasPrivKey, address)
+	}
+	if ws.IsWatchOnly(address) || ws.IsMultisig(address) {
+		return false, nil
+	}
+
+	if ws.WatchOnly == nil {
+		ws.WatchOnly = make(map[string][]byte)
+	}
+	ws.WatchOnly[address] = publicKeyHash
+	return true, nil
+}
+
+func (ws *WalletSet) IsWatchOnly(address string) bool {
+	_, ok := ws.WatchOnly[address]
+	return ok
+}
+
+// adiciona o script multisig, retornando o seu endereço e se ele
+// ainda não fazia parte das carteiras
+func (ws *WalletSet) AddMultisig(script *MultisigScript) (string, bool) {
+	address := script.Address()
+	if ws.IsMultisig(address) {
+		return address, false
+	}
+
+	if ws.Multisig == nil {
+		ws.Multisig = make(map[string][]byte)
+	}
+	ws.Multisig[address] = script.Serialize()
+	delete(ws.WatchOnly, address)
+	return address, true
+}
+
+func (ws *WalletSet) IsMultisig(address string) bool {
+	_, ok := ws.Multisig[address]
+	return ok
+}
+
+func (ws *WalletSet) GetMultisig(address string) (*MultisigScript, error) {
+	data, ok := ws.Multisig[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+	return ParseMultisigScript(data)
+}
+
+// retorna os endereços da carteira que possuem uma das chaves do script
+func (ws *WalletSet) MultisigSigners(script *MultisigScript) []Wallet {
+	var signers []Wallet
+	for _, publicKey := range script.PublicKeys {
+		address := AddressFromPublicKeyHash(PublicKeyHash(publicKey))
+		if wallet, ok := ws.Wallets[address]; ok {
+			signers = append(signers, *wallet)
+		}
+	}
+	return signers
+}
+
+// retorna os endereços com e sem chave privada em ordem alfabetica
+func (ws *WalletSet) GetAllAddresses() []string {
+	var addresses []string
+
+	for address := range ws.Wallets {
+		addresses = append(addresses, address)
+	}
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
+	for address := range ws.Multisig {
+		addresses = append(addresses, address)
+	}
+
+	sort.Strings(addresses)
+	return addresses
+}
+
+// define o nome do endereço, um nome vazio remove o atual
+func (ws *WalletSet) SetLabel(address, label string) error {
+	_, ok := ws.Wallets[address]
+	if !ok && !ws.IsWatchOnly(address) && !ws.IsMultisig(address) {
+		return fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+
+	if label == "" {
+		delete(ws.Labels, address)
+		return nil
+	}
+
+	if ws.Labels == nil {
+		ws.Labels = make(map[string]string)
+	}
+	ws.Labels[address] = label
+	return nil
+}
+
+func (ws *WalletSet) Label(address string) string {
+	return ws.Labels[address]
+}
+
+// retorna os endereços com o nome informado em ordem alfabetica
+func (ws *WalletSet) GetAddressesByLabel(label string) []string {
+	var addresses []string
+
+	for address, name := range ws.Labels {
+		if name == label {
+			addresses = append(addresses, address)
+		}
+	}
+
+	sort.Strings(addresses)
+	return addresses
+}
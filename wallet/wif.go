@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// sufixo das chaves WIF com chave publica comprimida
+	wifCompressedFlag = 0x01
+)
+
+var (
+	// primeiro byte das chaves privadas no formato WIF, muda de acordo com a rede
+	WIFVersion = byte(0x80)
+)
+
+// codifica a chave no Wallet Import Format: versão, chave, a flag
+// de compressão e o checksum, tudo em base58
+func EncodeWIF(privateKey PrivateKey) string {
+	payload := append([]byte{WIFVersion}, privateKey.D...)
+	if privateKey.Type == KeyCompressed {
+		payload = append(payload, wifCompressedFlag)
+	}
+	return string(Base58Encode(append(payload, Checksum(payload)...)))
+}
+
+func DecodeWIF(wif string) (PrivateKey, error) {
+	fullHash, err := Base58Decode([]byte(wif))
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	if len(fullHash) != 1+privateKeyLength+checksumLength && len(fullHash) != 2+privateKeyLength+checksumLength {
+		return PrivateKey{}, fmt.Errorf("%w: WIF key has %d bytes", ErrInvalidKey, len(fullHash))
+	}
+
+	payload := fullHash[:len(fullHash)-checksumLength]
+	if !bytes.Equal(fullHash[len(fullHash)-checksumLength:], Checksum(payload)) {
+		return PrivateKey{}, fmt.Errorf("%w: WIF key has an invalid checksum", ErrInvalidKey)
+	}
+
+	if payload[0] != WIFVersion {
+		return PrivateKey{}, fmt.Errorf("%w: WIF key belongs to another network", ErrInvalidKey)
+	}
+
+	keyType := KeyUncompressed
+	if len(payload) == 2+privateKeyLength {
+		if payload[len(payload)-1] != wifCompressedFlag {
+			return PrivateKey{}, fmt.Errorf("%w: invalid WIF compression flag", ErrInvalidKey)
+		}
+		keyType = KeyCompressed
+	}
+
+	return ParsePrivateKey(payload[1:1+privateKeyLength], keyType)
+}
+
+// lê uma chave privada em PEM, hex ou WIF, as chaves
+// em hex não informam o tipo, que é passado a parte
+func DecodePrivateKey(text string, hexKeyType KeyType) (PrivateKey, error) {
+	text = strings.TrimSpace(text)
+
+	if strings.HasPrefix(text, "-----BEGIN") {
+		return PrivateKeyDecode([]byte(text))
+	}
+
+	if len(text) == 2*privateKeyLength {
+		if d, err := hex.DecodeString(text); err == nil {
+			return ParsePrivateKey(d, hexKeyType)
+		}
+	}
+
+	return DecodeWIF(text)
+}